@@ -0,0 +1,195 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Allowlist holds include and exclude patterns loaded from a
+// file. A metric is allowed if it matches any include pattern
+// (or there are none) and doesn't match any exclude pattern.
+//
+// Files ending in .yaml or .yml hold `include` and `exclude`
+// lists. Any other file holds one pattern per line, where lines
+// starting with ! are exclude patterns and lines starting with #
+// are comments.
+//
+// The file is checked for changes at the start of every export
+// cycle. A file that fails to parse is reported and the previous
+// patterns are kept.
+type Allowlist struct {
+	path     string
+	patterns atomic.Value
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	err     error
+}
+
+type allowlistPatterns struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+type allowlistFile struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// NewAllowlist loads the patterns of the allowlist file at path.
+func NewAllowlist(path string) (*Allowlist, error) {
+	a := &Allowlist{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Err returns the error of the last failed reload, if the
+// file hasn't been loaded successfully since.
+func (a *Allowlist) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.err
+}
+
+// refresh reloads the file if it changed since it was last read.
+func (a *Allowlist) refresh() {
+	if err := a.reload(); err != nil {
+		log.Printf("Error reloading allowlist %v, keeping previous patterns: %v", a.path, err)
+	}
+}
+
+func (a *Allowlist) reload() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		a.err = errors.Wrap(err, "Error reading allowlist file")
+		return a.err
+	}
+
+	if a.patterns.Load() != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return nil
+	}
+
+	// the file is only considered read once it parsed successfully, so
+	// a broken file is reported again on every cycle until it's fixed
+	content, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		a.err = errors.Wrap(err, "Error reading allowlist file")
+		return a.err
+	}
+
+	patterns, err := parseAllowlist(a.path, content)
+	if err != nil {
+		a.err = errors.Wrap(err, "Error parsing allowlist file")
+		return a.err
+	}
+
+	a.patterns.Store(patterns)
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	a.err = nil
+
+	return nil
+}
+
+func (a *Allowlist) current() *allowlistPatterns {
+	return a.patterns.Load().(*allowlistPatterns)
+}
+
+func parseAllowlist(path string, content []byte) (*allowlistPatterns, error) {
+	file := allowlistFile{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(content, &file); err != nil {
+			return nil, err
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "!"):
+				file.Exclude = append(file.Exclude, strings.TrimSpace(line[1:]))
+			default:
+				file.Include = append(file.Include, line)
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	include, err := compilePatterns(file.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compilePatterns(file.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &allowlistPatterns{
+		include: include,
+		exclude: exclude,
+	}, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := []*regexp.Regexp{}
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error compiling pattern %v", p))
+		}
+
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+func (p *allowlistPatterns) allows(name string) bool {
+	for _, re := range p.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+
+	if len(p.include) == 0 {
+		return true
+	}
+
+	for _, re := range p.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeAllowlist(t *testing.T, path string, content string, modTime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing allowlist file: %v", err)
+	}
+
+	// make sure the change is noticed even on coarse file system timestamps
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Error setting allowlist modification time: %v", err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+
+	return dir
+}
+
+func TestAllowlistNewlineDelimited(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "allowlist.txt")
+	writeAllowlist(t, path, "# exported metrics\n^kafka_\n!_debug$\n", timeNow)
+
+	allowlist, err := NewAllowlist(path)
+	if err != nil {
+		t.Fatalf("Error loading allowlist: %v", err)
+	}
+
+	want := map[string]bool{"kafka_bytes": true, "kafka_bytes_debug": false, "go_memory": false}
+	for name, allowed := range want {
+		if got := allowlist.current().allows(name); got != allowed {
+			t.Errorf("Allowlist failed for %v, expected %v, got %v", name, allowed, got)
+		}
+	}
+}
+
+func TestAllowlistReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "allowlist.yaml")
+	writeAllowlist(t, path, "include:\n  - ^kafka_\n", timeNow)
+
+	allowlist, err := NewAllowlist(path)
+	if err != nil {
+		t.Fatalf("Error loading allowlist: %v", err)
+	}
+
+	allowlistConfig := Config{IncludeFilter: dummyIncludeFilter, Allowlist: allowlist}
+
+	writeAllowlist(t, path, "include: [\n", timeNow.Add(time.Second))
+	filter, err := allowlistConfig.newMetricFilter()
+	if err != nil {
+		t.Fatalf("Error creating metric filter: %v", err)
+	}
+
+	if allowlist.Err() == nil {
+		t.Errorf("Expected error reloading invalid allowlist")
+	}
+
+	if !filter.matches("kafka_bytes") || filter.matches("go_memory") {
+		t.Errorf("Allowlist failed, expected previous patterns to be kept")
+	}
+
+	writeAllowlist(t, path, "include:\n  - ^go_\nexclude:\n  - _debug$\n", timeNow.Add(2*time.Second))
+	filter, err = allowlistConfig.newMetricFilter()
+	if err != nil {
+		t.Fatalf("Error creating metric filter: %v", err)
+	}
+
+	if allowlist.Err() != nil {
+		t.Errorf("Error reloading allowlist: %v", allowlist.Err())
+	}
+
+	if filter.matches("kafka_bytes") || !filter.matches("go_memory") || filter.matches("go_memory_debug") {
+		t.Errorf("Allowlist failed, expected reloaded patterns to be applied")
+	}
+}
+
+func TestAllowlistInvalidFile(t *testing.T) {
+	if _, err := NewAllowlist(filepath.Join(os.TempDir(), "missing-allowlist.txt")); err == nil {
+		t.Errorf("Expected error loading missing allowlist")
+	}
+}
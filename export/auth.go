@@ -0,0 +1,237 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	oauth2Timeout       = 10 * time.Second
+	oauth2RefreshBefore = 30 * time.Second
+)
+
+// Authenticator authenticates the requests sent by the HTTP
+// exporter, typically by setting their Authorization header.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// invalidator is implemented by authenticators caching
+// credentials, which are dropped on a 401 response.
+type invalidator interface {
+	invalidate()
+}
+
+// BasicAuth authenticates requests with HTTP basic auth.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the request's basic auth credentials.
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerToken authenticates requests with a static bearer token.
+type BearerToken string
+
+// Authenticate sets the request's bearer token.
+func (a BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(a))
+	return nil
+}
+
+// BearerTokenFile authenticates requests with the bearer token held
+// in the file at its path. The file is read on every request, so
+// tokens rotated on disk, such as projected service account tokens,
+// are picked up.
+type BearerTokenFile string
+
+// Authenticate sets the request's bearer token to the file's content.
+func (a BearerTokenFile) Authenticate(req *http.Request) error {
+	token, err := ioutil.ReadFile(string(a))
+	if err != nil {
+		return errors.Wrap(err, "Error reading bearer token file")
+	}
+
+	return BearerToken(strings.TrimSpace(string(token))).Authenticate(req)
+}
+
+// OAuth2Config holds the configurations of an OAuth2 client
+// credentials grant. The client authenticates to the TokenURL
+// with basic auth, and EndpointParams are added to the token
+// requests. Tokens are cached until RefreshBefore (30 seconds
+// by default) ahead of their expiry. Token requests are sent
+// with Client if set, or otherwise a client bounded by a 10
+// second timeout sending them through Transport or, by default,
+// a copy of http.DefaultTransport configured by TLS.
+type OAuth2Config struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams map[string]string
+	RefreshBefore  time.Duration
+	Client         *http.Client
+	Transport      http.RoundTripper
+	TLS            *TLSConfig
+}
+
+// oauth2ClientCredentials authenticates requests with bearer tokens
+// fetched from the token endpoint with the client credentials grant.
+// fetchMu lets a single request fetch a token at a time, while mu
+// only guards the cached token, so it isn't held during the fetch.
+type oauth2ClientCredentials struct {
+	config OAuth2Config
+	client *http.Client
+	now    func() time.Time
+
+	fetchMu sync.Mutex
+	mu      sync.Mutex
+	token   string
+	expiry  time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewOAuth2ClientCredentials returns an Authenticator that fetches
+// and caches bearer tokens with the OAuth2 client credentials grant.
+func NewOAuth2ClientCredentials(config OAuth2Config) (Authenticator, error) {
+	if config.TokenURL == "" {
+		return nil, errors.New("OAuth2 client credentials require a token URL")
+	}
+
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = oauth2RefreshBefore
+	}
+
+	clientConfig := HTTPConfig{Client: config.Client, Transport: config.Transport, TLS: config.TLS}
+	if config.Client == nil {
+		clientConfig.Timeout = oauth2Timeout
+	}
+
+	client, err := clientConfig.newClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating OAuth2 token client")
+	}
+
+	return &oauth2ClientCredentials{
+		config: config,
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// Authenticate sets the request's bearer token, fetching a new
+// token if none is cached or the cached one is about to expire.
+func (a *oauth2ClientCredentials) Authenticate(req *http.Request) error {
+	if token, ok := a.cachedToken(); ok {
+		return BearerToken(token).Authenticate(req)
+	}
+
+	a.fetchMu.Lock()
+	defer a.fetchMu.Unlock()
+
+	// another request may have fetched a token in the meantime
+	if token, ok := a.cachedToken(); ok {
+		return BearerToken(token).Authenticate(req)
+	}
+
+	token, expiry, err := a.fetchToken(req.Context())
+	if err != nil {
+		return errors.Wrap(err, "Error fetching OAuth2 token")
+	}
+
+	a.mu.Lock()
+	a.token, a.expiry = token, expiry
+	a.mu.Unlock()
+
+	return BearerToken(token).Authenticate(req)
+}
+
+// cachedToken returns the cached token unless it's about to expire.
+func (a *oauth2ClientCredentials) cachedToken() (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" || (!a.expiry.IsZero() && !a.now().Before(a.expiry.Add(-a.config.RefreshBefore))) {
+		return "", false
+	}
+
+	return a.token, true
+}
+
+// invalidate drops the cached token after the endpoint rejected
+// it, tokens without an expiry are otherwise cached for good.
+func (a *oauth2ClientCredentials) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.token = ""
+}
+
+// fetchToken requests a new token, returning it with its expiry.
+func (a *oauth2ClientCredentials) fetchToken(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.config.Scopes) != 0 {
+		form.Set("scope", strings.Join(a.config.Scopes, " "))
+	}
+
+	for k, v := range a.config.EndpointParams {
+		form.Set(k, v)
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, "POST", a.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "Error creating token request")
+	}
+
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	requested := a.now()
+	resp, err := a.client.Do(tokenReq)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "Error sending token request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", time.Time{}, newHTTPError(resp, requested)
+	}
+
+	token := oauth2TokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "Error unmarshalling token response")
+	}
+
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("Token response holds no access token")
+	}
+
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", time.Time{}, errors.Errorf("Unsupported token type %v", token.TokenType)
+	}
+
+	// a token without an expiry is cached until it's rejected
+	expiry := time.Time{}
+	if token.ExpiresIn > 0 {
+		expiry = requested.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token.AccessToken, expiry, nil
+}
@@ -0,0 +1,274 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTokenEndpoint is a stand-in for an OAuth2 token endpoint,
+// issuing numbered tokens to its client.
+type fakeTokenEndpoint struct {
+	t         *testing.T
+	expiresIn int64
+
+	mu     sync.Mutex
+	issued int
+}
+
+func (f *fakeTokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the client credentials are form encoded before basic auth
+	clientID, clientSecret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != "client" || clientSecret != "s3cr%t" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		f.t.Errorf("Error parsing token request: %v", err)
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		f.t.Errorf("Token request failed, expected client_credentials grant, got %v", grantType)
+	}
+
+	if scope := r.PostForm.Get("scope"); scope != "metrics:write telemetry" {
+		f.t.Errorf("Token request failed, expected scope %v, got %v", "metrics:write telemetry", scope)
+	}
+
+	f.issued++
+	json.NewEncoder(w).Encode(oauth2TokenResponse{
+		AccessToken: fmt.Sprintf("token-%v", f.issued),
+		TokenType:   "Bearer",
+		ExpiresIn:   f.expiresIn,
+	})
+}
+
+func authorization(t *testing.T, a Authenticator) string {
+	req, _ := http.NewRequest("POST", "http://localhost", nil)
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Error authenticating request: %v", err)
+	}
+
+	return req.Header.Get("Authorization")
+}
+
+func TestStaticAuthenticators(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("first\n"), 0600)
+
+	if got, want := authorization(t, BasicAuth{Username: "key", Password: "secret"}), "Basic a2V5OnNlY3JldA=="; got != want {
+		t.Errorf("Basic auth failed, expected %v, got %v", want, got)
+	}
+
+	if got, want := authorization(t, BearerToken("static")), "Bearer static"; got != want {
+		t.Errorf("Bearer token failed, expected %v, got %v", want, got)
+	}
+
+	if got, want := authorization(t, BearerTokenFile(tokenFile)), "Bearer first"; got != want {
+		t.Errorf("Bearer token file failed, expected %v, got %v", want, got)
+	}
+
+	// the file is read again on every request
+	ioutil.WriteFile(tokenFile, []byte("second"), 0600)
+	if got, want := authorization(t, BearerTokenFile(tokenFile)), "Bearer second"; got != want {
+		t.Errorf("Bearer token file failed, expected %v, got %v", want, got)
+	}
+
+	req, _ := http.NewRequest("POST", "http://localhost", nil)
+	if err := BearerTokenFile(filepath.Join(dir, "missing")).Authenticate(req); err == nil {
+		t.Errorf("Expected error authenticating with a missing token file")
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{t: t, expiresIn: 300}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	a, err := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cr%t",
+		Scopes:       []string{"metrics:write", "telemetry"},
+	})
+	if err != nil {
+		t.Fatalf("Error creating OAuth2 authenticator: %v", err)
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.(*oauth2ClientCredentials).now = func() time.Time { return now }
+
+	if got := authorization(t, a); got != "Bearer token-1" {
+		t.Errorf("OAuth2 failed, expected Bearer token-1, got %v", got)
+	}
+
+	// the token is cached until shortly before it expires
+	now = now.Add(4 * time.Minute)
+	if got := authorization(t, a); got != "Bearer token-1" {
+		t.Errorf("OAuth2 failed, expected cached Bearer token-1, got %v", got)
+	}
+
+	now = now.Add(30 * time.Second)
+	if got := authorization(t, a); got != "Bearer token-2" {
+		t.Errorf("OAuth2 failed, expected refreshed Bearer token-2, got %v", got)
+	}
+
+	if endpoint.issued != 2 {
+		t.Errorf("OAuth2 failed, expected 2 token requests, got %v", endpoint.issued)
+	}
+}
+
+func TestOAuth2ClientCredentialsInvalidClient(t *testing.T) {
+	server := httptest.NewServer(&fakeTokenEndpoint{t: t})
+	defer server.Close()
+
+	a, _ := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: server.URL, ClientID: "client", ClientSecret: "wrong"})
+	req, _ := http.NewRequest("POST", "http://localhost", nil)
+	if err := a.Authenticate(req); err == nil {
+		t.Errorf("Expected error authenticating with invalid client credentials")
+	}
+
+	if _, err := NewOAuth2ClientCredentials(OAuth2Config{}); err == nil {
+		t.Errorf("Expected error creating OAuth2 authenticator without a token URL")
+	}
+}
+
+func TestOAuth2ClientCredentialsTokenClient(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(&fakeTokenEndpoint{t: t})
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	tests := []OAuth2Config{
+		{Client: server.Client()},
+		{TLS: &TLSConfig{CAFile: caFile}},
+	}
+
+	for i, test := range tests {
+		test.TokenURL, test.ClientID, test.ClientSecret = server.URL, "client", "s3cr%t"
+		test.Scopes = []string{"metrics:write", "telemetry"}
+
+		a, err := NewOAuth2ClientCredentials(test)
+		if err != nil {
+			t.Fatalf("Error creating OAuth2 authenticator: %v", err)
+		}
+
+		if got, want := authorization(t, a), fmt.Sprintf("Bearer token-%v", i+1); got != want {
+			t.Errorf("OAuth2 over TLS failed, expected %v, got %v", want, got)
+		}
+	}
+
+	// the endpoint's certificate isn't trusted by default
+	a, _ := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: server.URL, ClientID: "client", ClientSecret: "s3cr%t"})
+	req, _ := http.NewRequest("POST", "http://localhost", nil)
+	if err := a.Authenticate(req); err == nil {
+		t.Errorf("Expected error fetching a token from an untrusted endpoint")
+	}
+
+	if _, err := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: server.URL, Client: server.Client(), TLS: &TLSConfig{}}); err == nil {
+		t.Errorf("Expected error creating OAuth2 authenticator with both a client and a TLS configuration")
+	}
+}
+
+func TestOAuth2ClientCredentialsConcurrentFetch(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{t: t}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		endpoint.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	a, _ := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cr%t",
+		Scopes:       []string{"metrics:write", "telemetry"},
+	})
+
+	var wg sync.WaitGroup
+	got := make([]string, 5)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i] = authorization(t, a)
+		}(i)
+	}
+
+	// the cached token can be dropped while a token is being fetched
+	time.Sleep(10 * time.Millisecond)
+	a.(invalidator).invalidate()
+	close(release)
+	wg.Wait()
+
+	for _, header := range got {
+		if header != "Bearer token-1" {
+			t.Errorf("Concurrent OAuth2 failed, expected Bearer token-1, got %v", got)
+			break
+		}
+	}
+
+	if endpoint.issued != 1 {
+		t.Errorf("Concurrent OAuth2 failed, expected 1 token request, got %v", endpoint.issued)
+	}
+}
+
+func TestHTTPExportMetricsOAuth2(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{t: t}
+	tokenServer := httptest.NewServer(endpoint)
+	defer tokenServer.Close()
+
+	// the first token is revoked, and a new one fetched after the 401
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	a, _ := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cr%t",
+		Scopes:       []string{"metrics:write", "telemetry"},
+	})
+
+	exportHTTP := HTTP{
+		address:       server.URL,
+		authenticator: a,
+		client:        server.Client(),
+		config:        config,
+	}
+
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err == nil {
+		t.Errorf("Expected error exporting metrics with a revoked token")
+	}
+
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+	}
+}
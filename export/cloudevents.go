@@ -0,0 +1,148 @@
+package export
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/resource"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CloudEventsMode selects how payloads are wrapped in CloudEvents.
+type CloudEventsMode int
+
+const (
+	// NoCloudEvents sends the payloads as they are.
+	NoCloudEvents CloudEventsMode = iota
+	// BinaryCloudEvents sends the payloads as they are, with the
+	// event's attributes in ce- prefixed HTTP headers or ce_
+	// prefixed Kafka headers.
+	BinaryCloudEvents
+	// StructuredCloudEvents sends the payloads inside a JSON
+	// event envelope.
+	StructuredCloudEvents
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+)
+
+// CloudEventsConfig holds the configurations of the CloudEvents
+// the payloads are wrapped in. Type defaults to the full name of
+// the payload's protobuf message. The source of the events is
+// derived from the resource of the exporting process.
+type CloudEventsConfig struct {
+	Mode CloudEventsMode
+	Type string
+}
+
+// cloudEvent holds the attributes and the data of a CloudEvent
+// in its JSON format. Binary data is base64 encoded.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	ID              string          `json:"id"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// cloudEventPayload is a payload ready to be sent, along with its
+// content type and, in binary mode, its event's attributes.
+type cloudEventPayload struct {
+	body        []byte
+	contentType string
+	attributes  map[string]string
+}
+
+// wrapCloudEvent wraps the payload, of the given message type,
+// in a new CloudEvent according to the config's mode.
+func (c Config) wrapCloudEvent(payload []byte, r *resource.Resource, md protoreflect.MessageDescriptor) (cloudEventPayload, error) {
+	contentType := c.encoder().ContentType()
+	if c.CloudEvents.Mode == NoCloudEvents {
+		return cloudEventPayload{body: payload, contentType: contentType}, nil
+	}
+
+	id, err := newCloudEventID()
+	if err != nil {
+		return cloudEventPayload{}, err
+	}
+
+	event := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            c.CloudEvents.Type,
+		Source:          cloudEventSource(r),
+		ID:              id,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: contentType,
+	}
+
+	if event.Type == "" {
+		event.Type = string(md.FullName())
+	}
+
+	switch c.CloudEvents.Mode {
+	case BinaryCloudEvents:
+		return cloudEventPayload{
+			body:        payload,
+			contentType: contentType,
+			attributes: map[string]string{
+				"specversion": event.SpecVersion,
+				"type":        event.Type,
+				"source":      event.Source,
+				"id":          event.ID,
+				"time":        event.Time,
+			},
+		}, nil
+	case StructuredCloudEvents:
+		if c.encoder() == JSONEncoder {
+			event.Data = payload
+		} else {
+			event.DataBase64 = payload
+		}
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			return cloudEventPayload{}, errors.Wrap(err, "Error marshalling CloudEvent")
+		}
+
+		return cloudEventPayload{body: body, contentType: cloudEventsContentType}, nil
+	default:
+		return cloudEventPayload{}, errors.Errorf("Unsupported CloudEvents mode %v", c.CloudEvents.Mode)
+	}
+}
+
+// cloudEventSource builds the event source URI reference from the
+// resource type and labels, such as /host?host.hostname=localhost.
+func cloudEventSource(r *resource.Resource) string {
+	if r == nil {
+		return "/"
+	}
+
+	labels := url.Values{}
+	for k, v := range r.Labels {
+		labels.Set(k, v)
+	}
+
+	source := url.URL{Path: "/" + r.Type, RawQuery: labels.Encode()}
+	return source.String()
+}
+
+// newCloudEventID returns a random (version 4) UUID.
+func newCloudEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "Error generating CloudEvent ID")
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,197 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestCloudEventSource(t *testing.T) {
+	r := &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "my host", "golang.version": "go1.14"}}
+
+	if got, want := cloudEventSource(r), "/host?golang.version=go1.14&host.hostname=my+host"; got != want {
+		t.Errorf("CloudEvent source failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestNewCloudEventID(t *testing.T) {
+	first, _ := newCloudEventID()
+	second, _ := newCloudEventID()
+
+	if !uuidPattern.MatchString(first) || first == second {
+		t.Errorf("New CloudEvent ID failed, expected unique UUIDs, got %v and %v", first, second)
+	}
+}
+
+func TestHTTPExportMetricsBinaryCloudEvents(t *testing.T) {
+	ceConfig := config
+	ceConfig.CloudEvents = CloudEventsConfig{Mode: BinaryCloudEvents}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("ce-type"); got != "opencensus.proto.agent.metrics.v1.ExportMetricsServiceRequest" {
+			t.Errorf("CloudEvents export failed, got type %v", got)
+		}
+
+		if got := r.Header.Get("ce-specversion"); got != cloudEventsSpecVersion {
+			t.Errorf("CloudEvents export failed, got spec version %v", got)
+		}
+
+		if !uuidPattern.MatchString(r.Header.Get("ce-id")) || r.Header.Get("ce-source") == "" || r.Header.Get("ce-time") == "" {
+			t.Errorf("CloudEvents export failed, got headers %v", r.Header)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if _, err := DecodeServiceRequest(body, ""); err != nil {
+			t.Errorf("Error decoding CloudEvent data: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{address: server.URL, client: server.Client(), config: ceConfig}
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+	}
+}
+
+func TestHTTPExportMetricsStructuredCloudEvents(t *testing.T) {
+	ceConfig := config
+	ceConfig.CloudEvents = CloudEventsConfig{Mode: StructuredCloudEvents, Type: "metrics"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); contentType != cloudEventsContentType {
+			t.Errorf("CloudEvents export failed, expected content type %v, got %v", cloudEventsContentType, contentType)
+		}
+
+		event := cloudEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Error unmarshalling CloudEvent: %v", err)
+			return
+		}
+
+		if event.Type != "metrics" || event.DataContentType != ProtobufEncoder.ContentType() {
+			t.Errorf("CloudEvents export failed, got event %v", event)
+		}
+
+		if _, err := DecodeServiceRequest(event.DataBase64, event.DataContentType); err != nil {
+			t.Errorf("Error decoding CloudEvent data: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{address: server.URL, client: server.Client(), config: ceConfig}
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+	}
+}
+
+// largeMetric returns a metric of many time series, to be split.
+func largeMetric(series int) *metricdata.Metric {
+	ts := []*metricdata.TimeSeries{}
+	for i := 0; i < series; i++ {
+		ts = append(ts, partitionedSeries("topic", fmt.Sprint(i), metricdata.NewInt64Point(timeNow, int64(i))))
+	}
+
+	return partitionedMetric(metricdata.TypeGaugeInt64, ts...)
+}
+
+func TestStructuredCloudEventsMaxPayloadBytes(t *testing.T) {
+	const maxBytes = 1000
+
+	ceConfig := config
+	ceConfig.MaxPayloadBytes = maxBytes
+	ceConfig.CloudEvents = CloudEventsConfig{Mode: StructuredCloudEvents}
+	ms := []*metricdata.Metric{largeMetric(40), renamed(largeMetric(40), "second")}
+
+	var mu sync.Mutex
+	sizes := []int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(body))
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{address: server.URL, client: server.Client(), config: ceConfig}
+	if err := exportHTTP.ExportMetrics(context.Background(), ms); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTP: %v", err)
+	}
+
+	// the envelope and the base64 encoded data count against the cap
+	events, err := Kafka{config: ceConfig, topicInfo: topicInfo, batched: true}.messagePayloads(ms, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+	for _, event := range events {
+		sizes = append(sizes, len(event.body))
+	}
+
+	if len(sizes) < 4 {
+		t.Errorf("Structured CloudEvents split failed, expected several bodies, got sizes %v", sizes)
+	}
+
+	for _, size := range sizes {
+		if size > maxBytes {
+			t.Errorf("Structured CloudEvents split failed, expected bodies of at most %v bytes, got sizes %v", maxBytes, sizes)
+			break
+		}
+	}
+}
+
+func TestStructuredCloudEventJSONData(t *testing.T) {
+	ceConfig := config
+	ceConfig.Encoder = JSONEncoder
+	ceConfig.CloudEvents = CloudEventsConfig{Mode: StructuredCloudEvents}
+
+	got, err := ceConfig.wrapCloudEvent([]byte(`{"metrics":[]}`), nil, ceConfig.payloadDescriptor(true))
+	if err != nil {
+		t.Fatalf("Error wrapping payload in CloudEvent: %v", err)
+	}
+
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatalf("Error unmarshalling CloudEvent: %v", err)
+	}
+
+	if want := map[string]interface{}{"metrics": []interface{}{}}; !reflect.DeepEqual(want, event["data"]) {
+		t.Errorf("Structured CloudEvent failed, expected data %v, got %v", want, event["data"])
+	}
+}
+
+func TestCloudEventKafkaHeaders(t *testing.T) {
+	got := messageHeaders(cloudEventPayload{
+		contentType: ProtobufEncoder.ContentType(),
+		attributes:  map[string]string{"type": "metrics", "id": "1"},
+	}, config.payloadDescriptor(false))
+
+	want := []kafka.Header{
+		{Key: contentTypeHeader, Value: []byte(ProtobufEncoder.ContentType())},
+		{Key: messageTypeHeader, Value: []byte("opencensus.proto.metrics.v1.Metric")},
+		{Key: "ce_id", Value: []byte("1")},
+		{Key: "ce_type", Value: []byte("metrics")},
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("CloudEvent Kafka headers failed, expected %v, got %v", want, got)
+	}
+
+	// batched messages hold service requests
+	got = messageHeaders(cloudEventPayload{contentType: ProtobufEncoder.ContentType()}, config.payloadDescriptor(true))
+	if string(got[1].Value) != "opencensus.proto.agent.metrics.v1.ExportMetricsServiceRequest" {
+		t.Errorf("Kafka message type header failed, expected ExportMetricsServiceRequest, got %s", got[1].Value)
+	}
+}
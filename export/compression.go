@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+// Compression is the algorithm HTTP request bodies are compressed
+// with, its value is sent as the Content-Encoding header.
+type Compression string
+
+const (
+	// NoCompression sends request bodies uncompressed.
+	NoCompression Compression = ""
+	// GzipCompression compresses request bodies with gzip.
+	GzipCompression Compression = "gzip"
+	// ZstdCompression compresses request bodies with Zstandard.
+	ZstdCompression Compression = "zstd"
+	// SnappyCompression compresses request bodies with the
+	// snappy block format.
+	SnappyCompression Compression = "snappy"
+)
+
+var compressionRatio = stats.Float64("compression_ratio", "the ratio of the uncompressed to the compressed payload size", "1")
+
+var compressionRatioView = &view.View{
+	Name:        "compression_ratio",
+	Measure:     compressionRatio,
+	Description: "the ratio of the uncompressed to the compressed payload size",
+	Aggregation: view.Distribution(1, 1.5, 2, 3, 5, 10, 20),
+}
+
+// the zstd encoder is created on first use and shared by
+// all exporters, EncodeAll is safe for concurrent use.
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+)
+
+func sharedZstdEncoder() (*zstd.Encoder, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+
+	return zstdEncoder, zstdEncoderErr
+}
+
+func (c Compression) validate() error {
+	switch c {
+	case NoCompression, GzipCompression, ZstdCompression, SnappyCompression:
+		return nil
+	default:
+		return errors.Errorf("Unsupported compression %v", c)
+	}
+}
+
+// compress returns the payload compressed with the algorithm.
+func (c Compression) compress(payload []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return payload, nil
+	case GzipCompression:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(payload); err != nil {
+			return nil, errors.Wrap(err, "Error writing gzip payload")
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "Error closing gzip writer")
+		}
+
+		return buf.Bytes(), nil
+	case ZstdCompression:
+		encoder, err := sharedZstdEncoder()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating zstd encoder")
+		}
+
+		return encoder.EncodeAll(payload, nil), nil
+	case SnappyCompression:
+		return snappy.Encode(nil, payload), nil
+	default:
+		return nil, errors.Errorf("Unsupported compression %v", c)
+	}
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompress reverses the compression of a payload.
+func decompress(c Compression, payload []byte) ([]byte, error) {
+	var res []byte
+	var err error
+
+	switch c {
+	case NoCompression:
+		res = payload
+	case GzipCompression:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(payload)); err == nil {
+			res, err = ioutil.ReadAll(r)
+		}
+	case ZstdCompression:
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(nil); err == nil {
+			res, err = d.DecodeAll(payload, nil)
+			d.Close()
+		}
+	case SnappyCompression:
+		res, err = snappy.Decode(nil, payload)
+	}
+
+	return res, err
+}
+
+func TestCompress(t *testing.T) {
+	want := bytes.Repeat([]byte("metric"), 100)
+
+	for _, c := range []Compression{NoCompression, GzipCompression, ZstdCompression, SnappyCompression} {
+		compressed, err := c.compress(want)
+		if err != nil {
+			t.Fatalf("Error compressing %v payload: %v", c, err)
+		}
+
+		if c != NoCompression && len(compressed) >= len(want) {
+			t.Errorf("Compress failed for %v, expected fewer than %v bytes, got %v", c, len(want), len(compressed))
+		}
+
+		got, err := decompress(c, compressed)
+		if err != nil {
+			t.Fatalf("Error decompressing %v payload: %v", c, err)
+		}
+
+		if !bytes.Equal(want, got) {
+			t.Errorf("Compress failed for %v, expected %v, got %v", c, want, got)
+		}
+	}
+}
+
+func TestCompressionValidate(t *testing.T) {
+	if err := Compression("lz4").validate(); err == nil {
+		t.Errorf("Expected error validating unsupported compression")
+	}
+}
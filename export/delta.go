@@ -0,0 +1,121 @@
+package export
+
+import (
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+// series that haven't been observed for this long are forgotten
+const deltaStaleAge = time.Hour
+
+// deltaTracker converts cumulative values to their increase since
+// the previous observation of their series. The first observation
+// of a series has no previous value and is skipped, and a value that
+// goes down or restarts is treated as reset to zero. Series that
+// haven't been observed for deltaStaleAge are forgotten.
+type deltaTracker struct {
+	mu            sync.Mutex
+	values        map[string]deltaValue
+	distributions map[string]deltaDistribution
+	latest        time.Time
+}
+
+type deltaValue struct {
+	value     float64
+	time      time.Time
+	startTime time.Time
+}
+
+type deltaDistribution struct {
+	distribution *metricdata.Distribution
+	time         time.Time
+	startTime    time.Time
+}
+
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{
+		values:        map[string]deltaValue{},
+		distributions: map[string]deltaDistribution{},
+	}
+}
+
+// value returns the increase of the series since its previous
+// observation, along with the time elapsed since then.
+func (d *deltaTracker) value(key string, startTime time.Time, observed time.Time, value float64) (float64, time.Duration, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.observe(observed)
+	previous, ok := d.values[key]
+	d.values[key] = deltaValue{value: value, time: observed, startTime: startTime}
+	if !ok {
+		return 0, 0, false
+	}
+
+	elapsed := observed.Sub(previous.time)
+	if value < previous.value || !startTime.Equal(previous.startTime) {
+		return value, elapsed, true
+	}
+
+	return value - previous.value, elapsed, true
+}
+
+// distribution returns the increase of the series' distribution
+// since its previous observation.
+func (d *deltaTracker) distribution(key string, startTime time.Time, observed time.Time, value *metricdata.Distribution) (*metricdata.Distribution, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.observe(observed)
+	previous, ok := d.distributions[key]
+	d.distributions[key] = deltaDistribution{distribution: copyDistribution(value), time: observed, startTime: startTime}
+	if !ok {
+		return nil, false
+	}
+
+	p := previous.distribution
+	if value.Count < p.Count || !startTime.Equal(previous.startTime) ||
+		!equalBounds(value.BucketOptions, p.BucketOptions) || len(value.Buckets) != len(p.Buckets) {
+		return value, true
+	}
+
+	delta := &metricdata.Distribution{
+		Count:         value.Count - p.Count,
+		Sum:           value.Sum - p.Sum,
+		BucketOptions: value.BucketOptions,
+		Buckets:       make([]metricdata.Bucket, len(value.Buckets)),
+	}
+
+	for i := range value.Buckets {
+		delta.Buckets[i].Count = value.Buckets[i].Count - p.Buckets[i].Count
+	}
+
+	return delta, true
+}
+
+func (d *deltaTracker) observe(observed time.Time) {
+	if observed.After(d.latest) {
+		d.latest = observed
+	}
+}
+
+// prune forgets the series that weren't observed
+// for deltaStaleAge before the latest observation.
+func (d *deltaTracker) prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, v := range d.values {
+		if d.latest.Sub(v.time) > deltaStaleAge {
+			delete(d.values, key)
+		}
+	}
+
+	for key, v := range d.distributions {
+		if d.latest.Sub(v.time) > deltaStaleAge {
+			delete(d.distributions, key)
+		}
+	}
+}
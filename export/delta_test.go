@@ -0,0 +1,46 @@
+package export
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeltaTrackerValue(t *testing.T) {
+	deltas := newDeltaTracker()
+
+	if _, _, ok := deltas.value("series", timeNow, timeNow, 10); ok {
+		t.Errorf("Delta tracker failed, expected first observation to be skipped")
+	}
+
+	tests := []struct {
+		start    time.Time
+		observed time.Time
+		value    float64
+		want     float64
+	}{
+		{start: timeNow, observed: timeNow.Add(10 * time.Second), value: 25, want: 15},
+		// a value going down is reset to zero
+		{start: timeNow, observed: timeNow.Add(20 * time.Second), value: 5, want: 5},
+		// so is a restarted series
+		{start: timeNow.Add(time.Second), observed: timeNow.Add(30 * time.Second), value: 8, want: 8},
+	}
+
+	for _, test := range tests {
+		got, elapsed, ok := deltas.value("series", test.start, test.observed, test.value)
+		if !ok || got != test.want || elapsed != 10*time.Second {
+			t.Errorf("Delta tracker failed, expected increase %v over %v, got %v over %v", test.want, 10*time.Second, got, elapsed)
+		}
+	}
+}
+
+func TestDeltaTrackerPrune(t *testing.T) {
+	deltas := newDeltaTracker()
+	deltas.value("stale", timeNow, timeNow, 1)
+	deltas.distribution("stale", timeNow, timeNow, distributionOf([]float64{1}, 0.5))
+	deltas.value("recent", timeNow, timeNow.Add(deltaStaleAge+time.Second), 1)
+	deltas.prune()
+
+	if _, ok := deltas.values["recent"]; !ok || len(deltas.values) != 1 || len(deltas.distributions) != 0 {
+		t.Errorf("Delta pruning failed, expected only the recent series to be kept, got %v and %v", deltas.values, deltas.distributions)
+	}
+}
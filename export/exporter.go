@@ -4,6 +4,7 @@
 package export
 
 import (
+	"regexp"
 	"sync"
 	"time"
 
@@ -15,6 +16,8 @@ import (
 // and data needed by all general exporters.
 type ExporterAgent struct {
 	metricexport.Exporter
+	config         Config
+	scheduler      *intervalScheduler
 	ir             *metricexport.IntervalReader
 	initReaderOnce sync.Once
 }
@@ -22,7 +25,23 @@ type ExporterAgent struct {
 // Config defines the data format of the general
 // configurations of an exporter.
 type Config struct {
-	IncludeFilter               string
+	IncludeFilter string
+	// IntervalOverrides report the metrics matching their
+	// filter at a different period than the rest.
+	IntervalOverrides []IntervalOverride
+	// Processors transform the metrics before they are exported.
+	Processors []Processor
+	// Allowlist further restricts the exported metrics.
+	Allowlist *Allowlist
+	// PayloadFormat selects the schema of the payloads.
+	PayloadFormat PayloadFormat
+	// Encoder selects the encoding of the payloads.
+	Encoder Encoder
+	// MaxPayloadBytes, if positive, caps the size of each
+	// HTTP request body or Kafka message.
+	MaxPayloadBytes int
+	// CloudEvents optionally wraps the payloads in CloudEvents.
+	CloudEvents                 CloudEventsConfig
 	reportingPeriodMilliseconds int
 }
 
@@ -34,34 +53,98 @@ func NewConfig(filter string, reportingPeriod int) Config {
 	}
 }
 
+// metricFilter matches metric names against a Config's
+// include filter and allowlist as they were at the start
+// of an export cycle.
+type metricFilter struct {
+	include   *regexp.Regexp
+	allowlist *allowlistPatterns
+}
+
+func (c Config) newMetricFilter() (*metricFilter, error) {
+	include, err := regexp.Compile(c.IncludeFilter)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error compiling regular expression")
+	}
+
+	filter := &metricFilter{include: include}
+	if c.Allowlist != nil {
+		c.Allowlist.refresh()
+		filter.allowlist = c.Allowlist.current()
+	}
+
+	return filter, nil
+}
+
+func (f *metricFilter) matches(name string) bool {
+	if !f.include.MatchString(name) {
+		return false
+	}
+
+	return f.allowlist == nil || f.allowlist.allows(name)
+}
+
 // a user should never have to use this explicitly. They would
 // simply instantiate an implemented exporter
-func newExporterAgent(exporter metricexport.Exporter) *ExporterAgent {
+func newExporterAgent(exporter metricexport.Exporter, config Config) *ExporterAgent {
 	return &ExporterAgent{
 		Exporter: exporter,
+		config:   config,
 	}
 }
 
 // Start creates the ExporterAgent's IntervalReader (if needed),
 // sets the reporting interval, and then starts the reader.
 func (e *ExporterAgent) Start(reportingPeriodms int) error {
+	var err error
 	e.initReaderOnce.Do(func() {
-		e.ir, _ = metricexport.NewIntervalReader(&metricexport.Reader{}, e.Exporter)
+		exporter := e.Exporter
+		if len(e.config.Processors) != 0 {
+			exporter = &processingExporter{
+				Exporter:   exporter,
+				processors: e.config.Processors,
+			}
+		}
+
+		if len(e.config.IntervalOverrides) != 0 {
+			e.scheduler, err = newIntervalScheduler(exporter, e.config.IntervalOverrides)
+			if err != nil {
+				return
+			}
+			exporter = e.scheduler
+		}
+
+		e.ir, _ = metricexport.NewIntervalReader(&metricexport.Reader{}, exporter)
 	})
 
+	if err != nil {
+		return errors.Wrap(err, "Failed to create interval scheduler")
+	}
+
 	if e.ir == nil {
 		return errors.New("Failed to create Interval Reader")
 	}
 
+	if e.scheduler != nil {
+		e.scheduler.setReportingPeriod(reportingPeriodms)
+	}
+
 	e.ir.ReportingInterval = time.Duration(reportingPeriodms) * time.Millisecond
 	return e.ir.Start()
 }
 
-// Stop stops the ExporterAgent's interval reader.
-func (e *ExporterAgent) Stop() {
-	if k, ok := e.Exporter.(Kafka); ok {
-		k.Stop()
-	}
+// stopper is implemented by exporters holding resources,
+// such as producers or connections, that are closed on Stop.
+type stopper interface {
+	Stop()
+}
 
+// Stop stops the ExporterAgent's interval reader and then
+// releases the resources held by the exporter.
+func (e *ExporterAgent) Stop() {
 	e.ir.Stop()
+
+	if s, ok := e.Exporter.(stopper); ok {
+		s.Stop()
+	}
 }
@@ -1,13 +1,14 @@
 package export
 
 import (
+	"reflect"
 	"testing"
 )
 
 func TestNewConfig(t *testing.T) {
 	got := NewConfig(dummyIncludeFilter, dummyReportingPeriod)
 
-	if config != got {
+	if !reflect.DeepEqual(config, got) {
 		t.Errorf("New Config failed, expected %v, got %v", config, got)
 	}
 }
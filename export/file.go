@@ -0,0 +1,368 @@
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// FileFormat selects how the records of the file exporter are written.
+type FileFormat int
+
+const (
+	// DelimitedProtobufFormat writes every record in the protobuf
+	// binary format, prefixed by its length as a varint.
+	DelimitedProtobufFormat FileFormat = iota
+	// NDJSONFormat writes every record as a line of protobuf JSON.
+	NDJSONFormat
+)
+
+// FsyncPolicy selects when the file exporter flushes the file to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncOnRotate syncs a file when it's rotated or closed.
+	FsyncOnRotate FsyncPolicy = iota
+	// FsyncEveryWrite syncs the file after every record.
+	FsyncEveryWrite
+	// FsyncNever leaves flushing to the operating system.
+	FsyncNever
+)
+
+// rotatedFileTimeFormat suffixes the rotated files, it
+// sorts lexically in the order the files were rotated
+const rotatedFileTimeFormat = "20060102T150405.000000000Z"
+
+// FileConfig holds the configurations of the file exporter. Records
+// are appended to the file at Path, which is rotated once it would
+// grow beyond MaxBytes or gets older than MaxAge (if positive).
+// Rotated files are renamed with a timestamp suffix and optionally
+// gzipped. Only the last MaxBackups of them are kept if positive.
+type FileConfig struct {
+	Path       string
+	Format     FileFormat
+	MaxBytes   int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+	Fsync      FsyncPolicy
+}
+
+// File is an exporter that writes every export cycle as
+// a service request record to a rotating local file.
+type File struct {
+	fileConfig FileConfig
+	writer     *rotatingFile
+	config     Config
+}
+
+// NewFile returns a new exporter agent with a File exporter attached
+func NewFile(fileConfig FileConfig, config Config) (*ExporterAgent, error) {
+	if fileConfig.Path == "" {
+		return nil, errors.New("File exporter requires a path")
+	}
+
+	exporter := File{
+		fileConfig: fileConfig,
+		writer:     &rotatingFile{config: fileConfig, now: time.Now},
+		config:     config,
+	}
+
+	agent := newExporterAgent(exporter, exporter.config)
+	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
+		return nil, errors.Wrap(err, "Couldn't Start Exporter")
+	}
+
+	return agent, nil
+}
+
+// Stop closes the file being written.
+func (e File) Stop() {
+	if err := e.writer.close(); err != nil {
+		log.Printf("Error closing metrics file %v: %v", e.fileConfig.Path, err)
+	}
+}
+
+// ExportMetrics appends the metrics to the file as a single record.
+func (e File) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	resource, err := TotDetector(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Error creating resource detector")
+	}
+
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	includeData := []*metricdata.Metric{}
+	for _, d := range data {
+		if filter.matches(d.Descriptor.Name) {
+			includeData = append(includeData, d)
+		}
+	}
+
+	if len(includeData) == 0 {
+		return nil
+	}
+
+	request, err := e.config.metricsToRequest(includeData, resource)
+	if err != nil {
+		return errors.Wrap(err, "Error converting metric to Proto")
+	}
+
+	record, err := e.fileConfig.Format.record(request)
+	if err != nil {
+		return errors.Wrap(err, "Marshalling error")
+	}
+
+	if err := e.writer.write(record); err != nil {
+		return errors.Wrap(err, "Error writing metrics file")
+	}
+
+	return nil
+}
+
+// record encodes the request as a record of the format.
+func (f FileFormat) record(m proto.Message) ([]byte, error) {
+	switch f {
+	case DelimitedProtobufFormat:
+		payload, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+
+		record := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(payload))
+		record = record[:binary.PutUvarint(record, uint64(len(payload)))]
+		return append(record, payload...), nil
+	case NDJSONFormat:
+		payload, err := protojson.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(payload, '\n'), nil
+	default:
+		return nil, errors.Errorf("Unsupported file format %v", f)
+	}
+}
+
+// rotatingFile appends records to a file, rotating
+// it according to the file exporter's configuration.
+type rotatingFile struct {
+	config FileConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func (r *rotatingFile) write(record []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return errors.Wrap(err, "Error opening file")
+		}
+	}
+
+	// a reopened file may already be due for rotation
+	if r.shouldRotate(int64(len(record))) {
+		if err := r.rotate(); err != nil {
+			return errors.Wrap(err, "Error rotating file")
+		}
+
+		if err := r.open(); err != nil {
+			return errors.Wrap(err, "Error opening file")
+		}
+	}
+
+	n, err := r.file.Write(record)
+	r.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if r.config.Fsync == FsyncEveryWrite {
+		return r.file.Sync()
+	}
+
+	return nil
+}
+
+func (r *rotatingFile) shouldRotate(recordSize int64) bool {
+	if r.config.MaxBytes > 0 && r.size > 0 && r.size+recordSize > r.config.MaxBytes {
+		return true
+	}
+
+	return r.config.MaxAge > 0 && r.now().Sub(r.openedAt) >= r.config.MaxAge
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.config.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(r.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = r.now()
+	// an existing file is aged from its last write, as
+	// its creation time isn't available everywhere
+	if r.size > 0 {
+		r.openedAt = info.ModTime()
+	}
+
+	return nil
+}
+
+// closeFile syncs (unless the policy says never) and closes the file.
+func (r *rotatingFile) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	var err error
+	if r.config.Fsync != FsyncNever {
+		err = r.file.Sync()
+	}
+
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	r.file = nil
+	return err
+}
+
+func (r *rotatingFile) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.closeFile()
+}
+
+// rotate renames the current file with a timestamp suffix, gzips
+// it if configured to, and removes the backups beyond retention.
+func (r *rotatingFile) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	rotated := r.config.Path + "." + r.now().UTC().Format(rotatedFileTimeFormat)
+	if err := os.Rename(r.config.Path, rotated); err != nil {
+		return err
+	}
+
+	if r.config.Compress {
+		if err := gzipFile(rotated, r.config.Fsync != FsyncNever); err != nil {
+			return errors.Wrap(err, "Error compressing rotated file")
+		}
+	}
+
+	return r.removeBackups()
+}
+
+func (r *rotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(r.config.Path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	// only files suffixed with a rotation time are backups
+	backups := []string{}
+	prefix := r.config.Path + "."
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ".gz")
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (r *rotatingFile) removeBackups() error {
+	if r.config.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > r.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// gzipFile replaces the file with its gzipped copy.
+func gzipFile(path string, fsync bool) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := gzip.NewWriter(out)
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		out.Close()
+		return err
+	}
+
+	if fsync {
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
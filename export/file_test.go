@@ -0,0 +1,236 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readDelimitedRecords reads the length-delimited records of a file.
+func readDelimitedRecords(t *testing.T, content []byte) [][]byte {
+	records := [][]byte{}
+	r := bytes.NewReader(content)
+
+	for r.Len() > 0 {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatalf("Error reading record length: %v", err)
+		}
+
+		record := make([]byte, size)
+		if _, err := r.Read(record); err != nil {
+			t.Fatalf("Error reading record: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func newTestFile(fileConfig FileConfig, now func() time.Time) File {
+	return File{
+		fileConfig: fileConfig,
+		writer:     &rotatingFile{config: fileConfig, now: now},
+		config:     config,
+	}
+}
+
+func TestFileExportMetricsDelimited(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.pb")
+	exporter := newTestFile(FileConfig{Path: path, Fsync: FsyncEveryWrite}, time.Now)
+
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+			t.Fatalf("Error exporting metrics to file: %v", err)
+		}
+	}
+	exporter.Stop()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading metrics file: %v", err)
+	}
+
+	records := readDelimitedRecords(t, content)
+	if len(records) != 2 {
+		t.Fatalf("File export failed, expected 2 records, got %v", len(records))
+	}
+
+	for _, record := range records {
+		got, err := DecodeServiceRequest(record, "")
+		if err != nil || len(got) != 1 || got[0].Descriptor.Name != dummyName {
+			t.Errorf("File export failed, got record %v (%v)", got, err)
+		}
+	}
+}
+
+func TestFileExportMetricsNDJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.ndjson")
+	exporter := newTestFile(FileConfig{Path: path, Format: NDJSONFormat}, time.Now)
+
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+			t.Fatalf("Error exporting metrics to file: %v", err)
+		}
+	}
+	exporter.Stop()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening metrics file: %v", err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+		if _, err := DecodeServiceRequest(scanner.Bytes(), JSONEncoder.ContentType()); err != nil {
+			t.Errorf("File export failed, got invalid line %s: %v", scanner.Bytes(), err)
+		}
+	}
+
+	if lines != 2 {
+		t.Errorf("File export failed, expected 2 lines, got %v", lines)
+	}
+}
+
+func TestFileRotationRetention(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	path := filepath.Join(dir, "metrics.pb")
+	writer := &rotatingFile{
+		config: FileConfig{Path: path, MaxBytes: 10, MaxBackups: 2, Compress: true},
+		now:    clock,
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := writer.write(bytes.Repeat([]byte{byte('a' + i)}, 8)); err != nil {
+			t.Fatalf("Error writing record: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	writer.close()
+
+	backups, err := writer.backups()
+	if err != nil {
+		t.Fatalf("Error listing backups: %v", err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("File rotation failed, expected 2 backups, got %v", backups)
+	}
+
+	// the oldest backup was removed, the remaining ones hold the second and third records
+	for i, backup := range backups {
+		file, err := os.Open(backup)
+		if err != nil {
+			t.Fatalf("Error opening backup: %v", err)
+		}
+
+		r, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Error reading gzipped backup %v: %v", backup, err)
+		}
+
+		got, _ := ioutil.ReadAll(r)
+		file.Close()
+
+		if want := bytes.Repeat([]byte{byte('b' + i)}, 8); !bytes.Equal(want, got) {
+			t.Errorf("File rotation failed, expected backup %v to hold %s, got %s", backup, want, got)
+		}
+	}
+
+	if current, _ := ioutil.ReadFile(path); !bytes.Equal(current, []byte("dddddddd")) {
+		t.Errorf("File rotation failed, expected current file to hold the last record, got %s", current)
+	}
+}
+
+func TestFileRotationMaxAge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	writer := &rotatingFile{
+		config: FileConfig{Path: filepath.Join(dir, "metrics.pb"), MaxAge: time.Hour},
+		now:    func() time.Time { return now },
+	}
+
+	for _, record := range []string{"first", "second"} {
+		if err := writer.write([]byte(record)); err != nil {
+			t.Fatalf("Error writing record: %v", err)
+		}
+		now = now.Add(30 * time.Minute)
+	}
+
+	if backups, _ := writer.backups(); len(backups) != 0 {
+		t.Errorf("File rotation failed, expected no backups before max age, got %v", backups)
+	}
+
+	if err := writer.write([]byte("third")); err != nil {
+		t.Fatalf("Error writing record: %v", err)
+	}
+	writer.close()
+
+	if backups, _ := writer.backups(); len(backups) != 1 {
+		t.Errorf("File rotation failed, expected 1 backup after max age, got %v", backups)
+	}
+}
+
+func TestFileRotationMaxAgeReopened(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.pb")
+	if err := ioutil.WriteFile(path, []byte("previous"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	// the file was last written to by a previous process
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, now, now); err != nil {
+		t.Fatalf("Error setting file modification time: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	writer := &rotatingFile{
+		config: FileConfig{Path: path, MaxAge: time.Hour},
+		now:    func() time.Time { return now },
+	}
+
+	if err := writer.write([]byte("current")); err != nil {
+		t.Fatalf("Error writing record: %v", err)
+	}
+	writer.close()
+
+	if backups, _ := writer.backups(); len(backups) != 1 {
+		t.Errorf("File rotation failed, expected the reopened file to be rotated, got backups %v", backups)
+	}
+
+	if current, _ := ioutil.ReadFile(path); string(current) != "current" {
+		t.Errorf("File rotation failed, expected current file to hold the new record, got %s", current)
+	}
+}
+
+func TestNewFileWithoutPath(t *testing.T) {
+	if _, err := NewFile(FileConfig{}, config); err == nil {
+		t.Errorf("Expected error creating File exporter without path")
+	}
+}
@@ -0,0 +1,285 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+const (
+	// DefaultGraphiteTemplate builds paths from the metric name
+	// followed by its label values.
+	DefaultGraphiteTemplate = `{{.Name}}{{range .LabelValues}}.{{.}}{{end}}`
+
+	graphiteTimeout      = 10 * time.Second
+	graphiteProbeTimeout = time.Millisecond
+)
+
+var (
+	invalidGraphiteNameChars      = regexp.MustCompile(`[^a-zA-Z0-9_\-:.]`)
+	invalidGraphiteComponentChars = regexp.MustCompile(`[^a-zA-Z0-9_\-:]`)
+	repeatedGraphiteSeparators    = regexp.MustCompile(`\.{2,}`)
+)
+
+// GraphiteConfig holds the configurations of a Graphite/Carbon
+// plaintext endpoint. Template is a text/template executed with
+// GraphiteTemplateData to build the metric paths, it defaults to
+// DefaultGraphiteTemplate.
+type GraphiteConfig struct {
+	Address  string
+	Template string
+}
+
+// GraphiteTemplateData is the data the path template is executed
+// with. Dots in the metric name are kept as path separators, while
+// the label and resource values are sanitized into single components.
+type GraphiteTemplateData struct {
+	Name        string
+	Labels      map[string]string
+	LabelValues []string
+	Resource    map[string]string
+}
+
+// Graphite is an exporter that exports metrics to a Graphite/Carbon
+// plaintext endpoint. The TCP connection is reused between exports.
+type Graphite struct {
+	graphiteConfig GraphiteConfig
+	template       *template.Template
+	conn           *graphiteConn
+	config         Config
+}
+
+// NewGraphite returns a new exporter agent with a Graphite exporter attached
+func NewGraphite(graphiteConfig GraphiteConfig, config Config) (*ExporterAgent, error) {
+	if graphiteConfig.Template == "" {
+		graphiteConfig.Template = DefaultGraphiteTemplate
+	}
+
+	tmpl, err := template.New("graphite").Option("missingkey=zero").Parse(graphiteConfig.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing Graphite path template")
+	}
+
+	exporter := Graphite{
+		graphiteConfig: graphiteConfig,
+		template:       tmpl,
+		conn:           &graphiteConn{address: graphiteConfig.Address},
+		config:         config,
+	}
+
+	agent := newExporterAgent(exporter, exporter.config)
+	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
+		return nil, errors.Wrap(err, "Couldn't Start Exporter")
+	}
+
+	return agent, nil
+}
+
+// Stop closes the connection to the Graphite endpoint.
+func (e Graphite) Stop() {
+	e.conn.close()
+}
+
+// ExportMetrics converts the metrics to plaintext lines and
+// writes them to the Graphite endpoint.
+func (e Graphite) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	resource, err := TotDetector(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Error creating resource detector")
+	}
+
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	var payload bytes.Buffer
+	for _, d := range data {
+		if !filter.matches(d.Descriptor.Name) {
+			continue
+		}
+
+		if err := e.writeMetric(&payload, d, resource.Labels); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error converting metric %v to Graphite", d.Descriptor.Name))
+		}
+	}
+
+	if payload.Len() == 0 {
+		return nil
+	}
+
+	if err := e.conn.write(payload.Bytes()); err != nil {
+		return errors.Wrap(err, "Error sending metrics")
+	}
+
+	return nil
+}
+
+func sanitizeGraphiteComponent(s string) string {
+	return invalidGraphiteComponentChars.ReplaceAllString(s, "_")
+}
+
+func sanitizeGraphiteMap(m map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range m {
+		res[k] = sanitizeGraphiteComponent(v)
+	}
+
+	return res
+}
+
+func (e Graphite) path(m *metricdata.Metric, ts *metricdata.TimeSeries, resourceLabels map[string]string) (string, error) {
+	data := GraphiteTemplateData{
+		Name:        invalidGraphiteNameChars.ReplaceAllString(m.Descriptor.Name, "_"),
+		Labels:      map[string]string{},
+		LabelValues: []string{},
+		Resource:    sanitizeGraphiteMap(resourceLabels),
+	}
+
+	for i, lv := range ts.LabelValues {
+		if !lv.Present || i >= len(m.Descriptor.LabelKeys) {
+			continue
+		}
+
+		value := sanitizeGraphiteComponent(lv.Value)
+		data.Labels[m.Descriptor.LabelKeys[i].Key] = value
+		data.LabelValues = append(data.LabelValues, value)
+	}
+
+	var b strings.Builder
+	if err := e.template.Execute(&b, data); err != nil {
+		return "", errors.Wrap(err, "Error executing Graphite path template")
+	}
+
+	path := repeatedGraphiteSeparators.ReplaceAllString(b.String(), ".")
+	return strings.Trim(path, "."), nil
+}
+
+// writeMetric writes a line per point, distributions and summaries
+// are written as count, sum and p<percentile> sub-paths.
+func (e Graphite) writeMetric(w *bytes.Buffer, m *metricdata.Metric, resourceLabels map[string]string) error {
+	for _, ts := range m.TimeSeries {
+		path, err := e.path(m, ts, resourceLabels)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ts.Points {
+			timestamp := p.Time.Unix()
+			line := func(suffix string, value float64) {
+				fmt.Fprintf(w, "%v%v %v %v\n", path, suffix, formatFloat(value), timestamp)
+			}
+
+			switch v := p.Value.(type) {
+			case int64:
+				line("", float64(v))
+			case float64:
+				line("", v)
+			case *metricdata.Distribution:
+				line(".count", float64(v.Count))
+				line(".sum", v.Sum)
+
+				if v.Count > 0 {
+					for _, percentile := range defaultPercentiles {
+						line(".p"+formatFloat(percentile), estimatePercentile(v, percentile))
+					}
+				}
+			case *metricdata.Summary:
+				line(".count", float64(v.Count))
+				line(".sum", v.Sum)
+
+				for _, percentile := range sortedPercentiles(v) {
+					line(".p"+formatFloat(percentile), v.Snapshot.Percentiles[percentile])
+				}
+			default:
+				return errors.New("Unsupported value type")
+			}
+		}
+	}
+
+	return nil
+}
+
+// graphiteConn is a TCP connection to a Graphite endpoint that is
+// reused between writes and reopened when the endpoint closed it or
+// a write fails.
+type graphiteConn struct {
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// write sends the payload, reconnecting and retrying once if the
+// connection was broken. Resending a payload is safe since Graphite
+// keeps the last value written for a path and timestamp.
+func (c *graphiteConn) write(payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a write to a connection closed by the endpoint still succeeds
+	// into the socket buffer and is lost, so check it beforehand
+	if c.conn != nil && !connAlive(c.conn) {
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			c.conn, err = net.DialTimeout("tcp", c.address, graphiteTimeout)
+			if err != nil {
+				c.conn = nil
+				return errors.Wrap(err, "Error connecting to Graphite")
+			}
+		}
+
+		if err = c.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout)); err == nil {
+			if _, err = c.conn.Write(payload); err == nil {
+				return nil
+			}
+		}
+
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return errors.Wrap(err, "Error writing to Graphite")
+}
+
+// connAlive probes the connection with a short read. Graphite never
+// writes back, so the read times out unless the endpoint closed its
+// end or reset the connection.
+func connAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(graphiteProbeTimeout)); err != nil {
+		return false
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return err == nil
+}
+
+func (c *graphiteConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
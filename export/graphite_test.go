@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"text/template"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func newTestGraphite(t *testing.T, address string, tmpl string) Graphite {
+	parsed, err := template.New("graphite").Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		t.Fatalf("Error parsing Graphite path template: %v", err)
+	}
+
+	return Graphite{
+		graphiteConfig: GraphiteConfig{Address: address, Template: tmpl},
+		template:       parsed,
+		conn:           &graphiteConn{address: address},
+		config:         config,
+	}
+}
+
+func TestGraphitePath(t *testing.T) {
+	m := renamed(metric, "kafka/bytes.in")
+	m.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{
+			LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("topic.a b")},
+			Points:      metric.TimeSeries[0].Points,
+		},
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{DefaultGraphiteTemplate, "kafka_bytes.in.topic_a_b"},
+		{`{{index .Resource "host.hostname"}}.{{.Name}}.{{.Labels.Key}}`, "my_host.kafka_bytes.in.topic_a_b"},
+		{`{{.Resource.missing}}.{{.Name}}..{{.Labels.missing}}`, "kafka_bytes.in"},
+	}
+
+	for _, test := range tests {
+		exporter := newTestGraphite(t, "", test.template)
+
+		got, err := exporter.path(m, m.TimeSeries[0], map[string]string{"host.hostname": "my.host"})
+		if err != nil {
+			t.Fatalf("Error building Graphite path: %v", err)
+		}
+
+		if got != test.want {
+			t.Errorf("Graphite path failed for template %v, expected %v, got %v", test.template, test.want, got)
+		}
+	}
+}
+
+func TestNewGraphiteInvalidTemplate(t *testing.T) {
+	if _, err := NewGraphite(GraphiteConfig{Template: "{{.Name"}, config); err == nil {
+		t.Errorf("Expected error creating Graphite exporter with invalid template")
+	}
+}
+
+func TestGraphiteExportMetricsReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening on TCP: %v", err)
+	}
+	defer listener.Close()
+
+	exporter := newTestGraphite(t, listener.Addr().String(), DefaultGraphiteTemplate)
+	defer exporter.Stop()
+
+	want := fmt.Sprintf("%v.Val %v %v\n", dummyName, intVal, timeNow.Unix())
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+			t.Fatalf("Error exporting metrics to Graphite: %v", err)
+		}
+
+		// without reconnecting, the second line is lost and never accepted
+		listener.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Error accepting connection: %v", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != want {
+			t.Errorf("Graphite export failed, expected %v, got %v (%v)", want, got, err)
+		}
+
+		// the endpoint closes the connection, the next export has to reconnect
+		conn.Close()
+	}
+}
+
+func TestGraphiteDistribution(t *testing.T) {
+	exporter := newTestGraphite(t, "", DefaultGraphiteTemplate)
+
+	var payload bytes.Buffer
+	if err := exporter.writeMetric(&payload, distributionMetric, nil); err != nil {
+		t.Fatalf("Error converting metric to Graphite: %v", err)
+	}
+
+	want := []string{"metric.count", "metric.sum", "metric.p50", "metric.p95", "metric.p99"}
+	got := []string{}
+	scanner := bufio.NewScanner(&payload)
+	for scanner.Scan() {
+		var path string
+		fmt.Sscan(scanner.Text(), &path)
+		got = append(got, path)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Graphite distribution failed, expected %v, got %v", want, got)
+	}
+}
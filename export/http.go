@@ -3,41 +3,156 @@ package export
 import (
 	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"regexp"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.opencensus.io/metric/metricdata"
-	"google.golang.org/protobuf/proto"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
 )
 
 // HTTP is an exporter that exports metrics to an
 // HTTP endpoint
 type HTTP struct {
-	address   string
-	apiKey    string
-	apiSecret string
-	headerMap map[string]string
-	client    *http.Client
-	config    Config
+	address             string
+	apiKey              string
+	apiSecret           string
+	authenticator       Authenticator
+	headers             *httpHeaders
+	headerProvider      HeaderProvider
+	compression         Compression
+	minCompressionBytes int
+	client              *http.Client
+	backoff             *httpBackoff
+	config              Config
 }
 
+// HTTPConfig holds the configurations of an HTTP endpoint.
+// Request bodies of at least MinCompressionBytes are
+// compressed with Compression, smaller ones are sent raw.
+// TLS optionally configures the CAs and client certificate
+// of HTTPS connections. Requests are authenticated by the
+// Authenticator if set, or with APIKey and APISecret as
+// basic auth credentials. Requests are sent with Client if
+// set, or otherwise a client bounded by Timeout (30 seconds
+// by default) sending them through Transport, which defaults
+// to a copy of http.DefaultTransport honoring the proxy
+// environment variables. HeaderProvider optionally adds
+// headers to every request.
+type HTTPConfig struct {
+	Address             string
+	APIKey              string
+	APISecret           string
+	Authenticator       Authenticator
+	Compression         Compression
+	MinCompressionBytes int
+	TLS                 *TLSConfig
+	Client              *http.Client
+	Transport           http.RoundTripper
+	Timeout             time.Duration
+	HeaderProvider      HeaderProvider
+}
+
+// HeaderProvider returns headers to add to a request, it is
+// called with the export's context before every request.
+type HeaderProvider func(ctx context.Context) map[string]string
+
+// httpHeaders holds the static headers of the HTTP exporter's
+// requests, which can be changed while metrics are exported.
+type httpHeaders struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+func (h *httpHeaders) add(headerMap map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for k, v := range headerMap {
+		h.values[k] = v
+	}
+}
+
+func (h *httpHeaders) remove(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, k := range keys {
+		delete(h.values, k)
+	}
+}
+
+// apply adds the headers to the request.
+func (h *httpHeaders) apply(req *http.Request) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for k, v := range h.values {
+		req.Header.Add(k, v)
+	}
+}
+
+// defaultHTTPTimeout bounds the requests of the default client.
+const defaultHTTPTimeout = 30 * time.Second
+
+// maxDrainBytes caps how much of a successful response is read
+// before closing it, so that its connection can be reused.
+const maxDrainBytes = 64 << 10
+
 // NewHTTP returns a new exporter agent with an HTTP exporter attached
 func NewHTTP(address string, apiKey string, apiSecret string, config Config) (*ExporterAgent, error) {
-	headerMap := map[string]string{
-		"Content-Type": "application/x-protobuf",
+	return NewHTTPWithConfig(HTTPConfig{
+		Address:   address,
+		APIKey:    apiKey,
+		APISecret: apiSecret,
+	}, config)
+}
+
+// NewHTTPWithConfig returns a new exporter agent with an
+// HTTP exporter configured by httpConfig attached
+func NewHTTPWithConfig(httpConfig HTTPConfig, config Config) (*ExporterAgent, error) {
+	if err := httpConfig.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	if httpConfig.Compression != NoCompression {
+		if err := view.Register(compressionRatioView); err != nil {
+			return nil, errors.Wrap(err, "Error registering views")
+		}
 	}
 
+	client, err := httpConfig.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := &httpHeaders{values: map[string]string{
+		"Content-Type": config.encoder().ContentType(),
+	}}
+
 	exporter := HTTP{
-		address:   address,
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		headerMap: headerMap,
-		client:    &http.Client{},
-		config:    config,
+		address:             httpConfig.Address,
+		apiKey:              httpConfig.APIKey,
+		apiSecret:           httpConfig.APISecret,
+		authenticator:       httpConfig.Authenticator,
+		headers:             headers,
+		headerProvider:      httpConfig.HeaderProvider,
+		compression:         httpConfig.Compression,
+		minCompressionBytes: httpConfig.MinCompressionBytes,
+		client:              client,
+		backoff:             &httpBackoff{},
+		config:              config,
 	}
 
-	agent := newExporterAgent(exporter)
+	agent := newExporterAgent(exporter, exporter.config)
 	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
 		return nil, errors.Wrap(err, "Couldn't Start Exporter")
 	}
@@ -45,58 +160,209 @@ func NewHTTP(address string, apiKey string, apiSecret string, config Config) (*E
 	return agent, nil
 }
 
+// newClient returns the configured client, or builds one
+// from the configured transport, timeout and TLS settings.
+func (c HTTPConfig) newClient() (*http.Client, error) {
+	if c.Client != nil {
+		if c.Transport != nil || c.Timeout != 0 || c.TLS != nil {
+			return nil, errors.New("HTTP client can't be combined with a transport, timeout or TLS configuration")
+		}
+
+		return c.Client, nil
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	if c.Transport != nil {
+		if c.TLS != nil {
+			return nil, errors.New("HTTP transport can't be combined with a TLS configuration")
+		}
+
+		return &http.Client{Transport: c.Transport, Timeout: timeout}, nil
+	}
+
+	client := newDefaultHTTPClient()
+	client.Timeout = timeout
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.clientConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error configuring TLS")
+		}
+		transport := client.Transport.(*http.Transport)
+		transport.TLSClientConfig = tlsConfig
+
+		if c.TLS.ReloadCertificates && c.TLS.CAFile != "" {
+			if client.Transport, err = newCAReloadingTransport(c.TLS.CAFile, transport); err != nil {
+				return nil, errors.Wrap(err, "Error configuring TLS")
+			}
+		}
+	}
+
+	return client, nil
+}
+
+// newDefaultHTTPClient returns a client bounded by defaultHTTPTimeout
+// over a copy of http.DefaultTransport, which honors the proxy
+// environment variables.
+func newDefaultHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		Timeout:   defaultHTTPTimeout,
+	}
+}
+
+// headerSetter is implemented by exporters sending
+// requests with headers that can be changed at runtime.
+type headerSetter interface {
+	addHeaders(headerMap map[string]string)
+	removeHeaders(keys ...string)
+}
+
 // AddHeader adds a map of headers to the exporter for its HTTP request.
-func (e *ExporterAgent) AddHeader(headerMap map[string]string) {
-	for k, v := range headerMap {
-		e.Exporter.(HTTP).headerMap[k] = v
+// It's safe to call while metrics are exported, and returns an error
+// if the exporter doesn't send headers.
+func (e *ExporterAgent) AddHeader(headerMap map[string]string) error {
+	s, ok := e.Exporter.(headerSetter)
+	if !ok {
+		return errors.Errorf("Exporter %T doesn't support headers", e.Exporter)
 	}
+
+	s.addHeaders(headerMap)
+	return nil
+}
+
+// RemoveHeader removes headers from the exporter's HTTP requests.
+func (e *ExporterAgent) RemoveHeader(keys ...string) error {
+	s, ok := e.Exporter.(headerSetter)
+	if !ok {
+		return errors.Errorf("Exporter %T doesn't support headers", e.Exporter)
+	}
+
+	s.removeHeaders(keys...)
+	return nil
+}
+
+func (e HTTP) addHeaders(headerMap map[string]string) {
+	e.headers.add(headerMap)
+}
+
+func (e HTTP) removeHeaders(keys ...string) {
+	e.headers.remove(keys...)
 }
 
 // ExportMetrics converts the metrics to a metrics service request protobuf and
-// makes a POST request with that payload to an HTTP endpoint.
+// makes a POST request with that payload to an HTTP endpoint. Non-2xx responses
+// are returned as an *HTTPError, and the cycles within the delay asked for by a
+// Retry-After header are skipped.
 func (e HTTP) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	// the skipped cycle fails with the error that asked for it,
+	// so that it's classified as retryable
+	if wait, httpErr := e.backoff.wait(time.Now()); wait > 0 {
+		return errors.Wrapf(httpErr, "Backing off for %v as asked by the HTTP endpoint", wait)
+	}
+
 	includeData := []*metricdata.Metric{}
 	resource, err := TotDetector(ctx)
 	if err != nil {
 		return errors.Wrap(err, "Error creating resource detector")
 	}
 
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
 	for _, d := range data {
-		matched, err := regexp.Match(e.config.IncludeFilter, []byte(d.Descriptor.Name))
-		if err != nil {
-			return errors.Wrap(err, "Error matching regular expression")
-		} else if matched {
-			d.Resource = resource
+		if filter.matches(d.Descriptor.Name) {
 			includeData = append(includeData, d)
 		}
 	}
 
-	metricsRequestProto, err := metricsToServiceRequest(includeData)
-	if err != nil {
-		return errors.Wrap(err, "Error converting metric to Proto")
-	}
+	// batches are wrapped before they're measured, so that
+	// MaxPayloadBytes caps the bodies as they're sent
+	md := e.config.payloadDescriptor(true)
+	events, err := splitPayloads(includeData, e.config.MaxPayloadBytes, func(batch []*metricdata.Metric) (cloudEventPayload, error) {
+		metricsRequestProto, err := e.config.metricsToRequest(batch, resource)
+		if err != nil {
+			return cloudEventPayload{}, errors.Wrap(err, "Error converting metric to Proto")
+		}
+
+		payload, err := e.config.encoder().Encode(metricsRequestProto)
+		if err != nil {
+			return cloudEventPayload{}, errors.Wrap(err, "Marshalling error")
+		}
+
+		event, err := e.config.wrapCloudEvent(payload, resource, md)
+		if err != nil {
+			return cloudEventPayload{}, errors.Wrap(err, "Error wrapping payload in CloudEvent")
+		}
 
-	payload, err := proto.Marshal(metricsRequestProto)
+		return event, nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "Marshalling error")
+		return err
 	}
 
-	if err := e.postMetrics(payload); err != nil {
-		return errors.Wrap(err, "Error sending metrics")
+	for _, event := range events {
+		if err := e.postMetrics(ctx, event); err != nil {
+			return errors.Wrap(err, "Error sending metrics")
+		}
 	}
 
 	return nil
 }
 
-func (e HTTP) postMetrics(payload []byte) error {
-	req, err := http.NewRequest("POST", e.address, bytes.NewBuffer(payload))
+func (e HTTP) postMetrics(ctx context.Context, event cloudEventPayload) error {
+	payload := event.body
+	contentEncoding := ""
+	if e.compression != NoCompression && len(payload) >= e.minCompressionBytes {
+		compressed, err := e.compression.compress(payload)
+		if err != nil {
+			return errors.Wrap(err, "Error compressing payload")
+		}
+
+		if len(compressed) > 0 {
+			stats.Record(context.Background(), compressionRatio.M(float64(len(payload))/float64(len(compressed))))
+		}
+
+		payload = compressed
+		contentEncoding = string(e.compression)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.address, bytes.NewBuffer(payload))
 	if err != nil {
 		return errors.Wrap(err, "Error creating POST request")
 	}
-	req.SetBasicAuth(e.apiKey, e.apiSecret)
 
-	for headerKey, headerVal := range e.headerMap {
-		req.Header.Add(headerKey, headerVal)
+	authenticator := e.authenticator
+	if authenticator == nil {
+		authenticator = BasicAuth{Username: e.apiKey, Password: e.apiSecret}
+	}
+
+	if err := authenticator.Authenticate(req); err != nil {
+		return errors.Wrap(err, "Error authenticating request")
+	}
+
+	e.headers.apply(req)
+	if e.headerProvider != nil {
+		for k, v := range e.headerProvider(ctx) {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if e.config.CloudEvents.Mode == StructuredCloudEvents {
+		req.Header.Set("Content-Type", event.contentType)
+	}
+
+	for k, v := range event.attributes {
+		req.Header.Set("ce-"+k, v)
+	}
+
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
 	}
 
 	resp, err := e.client.Do(req)
@@ -105,5 +371,22 @@ func (e HTTP) postMetrics(payload []byte) error {
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		if i, ok := authenticator.(invalidator); ok {
+			i.invalidate()
+		}
+	}
+
+	if resp.StatusCode/100 != 2 {
+		now := time.Now()
+		httpErr := newHTTPError(resp, now)
+		if httpErr.RetryAfter > 0 {
+			e.backoff.set(now.Add(httpErr.RetryAfter), httpErr)
+		}
+
+		return httpErr
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainBytes))
 	return nil
 }
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxErrorBodyBytes caps how much of an error response's
+// body is kept in the HTTPError.
+const maxErrorBodyBytes = 1024
+
+// HTTPError is returned when the HTTP endpoint responds with a
+// non-2xx status. Body holds the start of the response body, and
+// RetryAfter the delay the server asked for in a 429 or 503
+// response's Retry-After header, if any.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("HTTP endpoint responded with status %v", e.Status)
+	}
+
+	return fmt.Sprintf("HTTP endpoint responded with status %v: %v", e.Status, e.Body)
+}
+
+// Retryable reports whether sending the same request again may
+// succeed: server errors, timeouts and throttling are retryable,
+// while other client errors, such as a bad request, failed
+// authentication or a too large payload, are permanent.
+func (e *HTTPError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode == http.StatusNotImplemented, e.StatusCode == http.StatusHTTPVersionNotSupported:
+		return false
+	default:
+		return e.StatusCode >= 500
+	}
+}
+
+// IsRetryableHTTPError reports whether err was caused by a
+// retryable HTTPError.
+func IsRetryableHTTPError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.Retryable()
+}
+
+// newHTTPError reads the start of the response body
+// into an HTTPError for the non-2xx response.
+func newHTTPError(resp *http.Response, now time.Time) *HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes+1))
+	truncated := len(body) > maxErrorBodyBytes
+	if truncated {
+		body = body[:maxErrorBodyBytes]
+	}
+
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+
+	if truncated {
+		httpErr.Body += "..."
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		httpErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+
+	return httpErr
+}
+
+// parseRetryAfter parses a Retry-After header, given either as
+// a number of seconds or as an HTTP date, into a delay from now.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// httpBackoff holds the time until which the HTTP exporter
+// holds off sending requests, as asked by the server, along
+// with the error of the response that asked for it.
+type httpBackoff struct {
+	mu    sync.Mutex
+	until time.Time
+	err   *HTTPError
+}
+
+// wait returns how long is left to hold off at now, and
+// the error of the response that asked for it.
+func (b *httpBackoff) wait(now time.Time) (time.Duration, *HTTPError) {
+	if b == nil {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.until) {
+		return b.until.Sub(now), b.err
+	}
+
+	return 0, nil
+}
+
+func (b *httpBackoff) set(until time.Time, err *HTTPError) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until.After(b.until) {
+		b.until = until
+		b.err = err
+	}
+}
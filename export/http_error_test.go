@@ -0,0 +1,128 @@
+package export
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHTTPErrorRetryable(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusRequestEntityTooLarge, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusNotImplemented, false},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, test := range tests {
+		err := errors.Wrap(&HTTPError{StatusCode: test.statusCode}, "Error sending metrics")
+		if got := IsRetryableHTTPError(err); got != test.want {
+			t.Errorf("HTTP error classification failed for %v, expected %v, got %v", test.statusCode, test.want, got)
+		}
+	}
+
+	if IsRetryableHTTPError(errors.New("Error sending request")) {
+		t.Errorf("HTTP error classification failed, expected a non-HTTP error not to be retryable")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.header, now); got != test.want {
+			t.Errorf("Retry-After parsing failed for %q, expected %v, got %v", test.header, test.want, got)
+		}
+	}
+}
+
+func TestHTTPExportMetricsErrorStatus(t *testing.T) {
+	body := strings.Repeat("x", 2*maxErrorBodyBytes)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, body, http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{
+		address: server.URL,
+		client:  server.Client(),
+		backoff: &httpBackoff{},
+		config:  config,
+	}
+
+	err := exportHTTP.ExportMetrics(context.Background(), metrics)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Metrics export failed, expected an HTTPError, got %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusRequestEntityTooLarge || httpErr.Retryable() {
+		t.Errorf("Metrics export failed, expected a permanent 413 error, got %v", httpErr.StatusCode)
+	}
+
+	if want := body[:maxErrorBodyBytes] + "..."; httpErr.Body != want {
+		t.Errorf("Metrics export failed, expected body truncated to %v bytes, got %v bytes", maxErrorBodyBytes, len(httpErr.Body))
+	}
+
+	if wait, _ := exportHTTP.backoff.wait(time.Now()); wait != 0 {
+		t.Errorf("Metrics export failed, expected no backoff without Retry-After, got %v", wait)
+	}
+}
+
+func TestHTTPExportMetricsRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{
+		address: server.URL,
+		client:  server.Client(),
+		backoff: &httpBackoff{},
+		config:  config,
+	}
+
+	err := exportHTTP.ExportMetrics(context.Background(), metrics)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || !httpErr.Retryable() || httpErr.RetryAfter != time.Minute {
+		t.Fatalf("Metrics export failed, expected a retryable error after %v, got %v", time.Minute, err)
+	}
+
+	// the next cycle is skipped without sending a request
+	err = exportHTTP.ExportMetrics(context.Background(), metrics)
+	if !IsRetryableHTTPError(err) || !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Metrics export failed, expected a retryable 429 error while backing off, got %v", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("Metrics export failed, expected 1 request while backing off, got %v", requests)
+	}
+}
@@ -1,14 +1,18 @@
 package export
 
 import (
-	"bytes"
 	"context"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	a1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,14 +24,13 @@ var (
 		"Content-Type": "application/x-protobuf",
 		"key":          "val",
 	}
-	exportPort = ":8081"
 
 	dummyHTTP = HTTP{
 		address:   address,
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
-		headerMap: headerMap,
-		client:    &http.Client{},
+		headers:   &httpHeaders{values: headerMap},
+		client:    &http.Client{Timeout: defaultHTTPTimeout},
 		config:    config,
 	}
 )
@@ -38,37 +41,39 @@ func TestNewHTTPAddHeader(t *testing.T) {
 		t.Errorf("Error creating NewHTTP")
 	}
 
-	got.AddHeader(map[string]string{"key": "val"})
+	if err := got.AddHeader(map[string]string{"key": "val"}); err != nil {
+		t.Errorf("Error adding header: %v", err)
+	}
 	got.Stop()
 
 	compareHTTP(t, dummyHTTP, got.Exporter.(HTTP))
 }
 
 func TestHTTPExportMetrics(t *testing.T) {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		got, _ := ioutil.ReadAll(r.Body)
-		metricsRequest, err := metricsToServiceRequest(metrics)
+		resource, _ := TotDetector(context.Background())
+		metricsRequest, err := metricsToServiceRequest(metrics, resource)
 		if err != nil {
 			t.Errorf("Error exporting metrics: %v", err)
 		}
 
-		want, err := proto.Marshal(metricsRequest)
-		if err != nil {
-			t.Fatalf("Marshalling error: %v", err)
+		// labels are maps, so the payload is compared once decoded
+		gotRequest := &a1.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(got, gotRequest); err != nil {
+			t.Errorf("Unmarshalling error: %v", err)
+			return
 		}
 
-		if res := bytes.Compare(got, want); res != 0 {
-			t.Errorf("Metrics export failed, expected %v, got %v", want, got)
+		if !proto.Equal(metricsRequest, gotRequest) {
+			t.Errorf("Metrics export failed, expected %v, got %v", metricsRequest, gotRequest)
 		}
-	})
-
-	go func() {
-		log.Fatal(http.ListenAndServe(exportPort, nil))
-	}()
+	}))
+	defer server.Close()
 
 	exportHTTP := HTTP{
-		address: "http://localhost" + exportPort,
-		client:  &http.Client{},
+		address: server.URL,
+		client:  server.Client(),
 		config:  config,
 	}
 
@@ -90,15 +95,287 @@ func compareHTTP(t *testing.T, want HTTP, got HTTP) {
 		t.Errorf("New HTTP failed, expected secret %v, got %v", want.apiSecret, got.apiSecret)
 	}
 
-	if !reflect.DeepEqual(want.headerMap, got.headerMap) {
-		t.Errorf("New HTTP failed, expected map %v, got %v", want.headerMap, got.headerMap)
+	if !reflect.DeepEqual(want.headers.values, got.headers.values) {
+		t.Errorf("New HTTP failed, expected map %v, got %v", want.headers.values, got.headers.values)
 	}
 
-	if !reflect.DeepEqual(want.client, got.client) {
-		t.Errorf("New HTTP failed, expected client %v, got %v", *want.client, *got.client)
+	if want.client.Timeout != got.client.Timeout {
+		t.Errorf("New HTTP failed, expected client timeout %v, got %v", want.client.Timeout, got.client.Timeout)
 	}
 
-	if want.config != got.config {
+	if !reflect.DeepEqual(want.config, got.config) {
 		t.Errorf("New HTTP failed, expected config %v, got %v", want.config, got.config)
 	}
 }
+
+func TestHTTPExportMetricsJSON(t *testing.T) {
+	jsonConfig := config
+	jsonConfig.Encoder = JSONEncoder
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); contentType != JSONEncoder.ContentType() {
+			t.Errorf("Metrics export failed, expected content type %v, got %v", JSONEncoder.ContentType(), contentType)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		got := &a1.ExportMetricsServiceRequest{}
+		if err := protojson.Unmarshal(body, got); err != nil {
+			t.Errorf("Error unmarshalling JSON payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	exportHTTP := HTTP{
+		address: server.URL,
+		headers: &httpHeaders{values: map[string]string{"Content-Type": jsonConfig.encoder().ContentType()}},
+		client:  server.Client(),
+		config:  jsonConfig,
+	}
+
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+	}
+}
+
+func TestHTTPExportMetricsCompressed(t *testing.T) {
+	tests := []struct {
+		minCompressionBytes int
+		wantEncoding        Compression
+	}{
+		{0, ZstdCompression},
+		{1 << 20, NoCompression},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := Compression(r.Header.Get("Content-Encoding"))
+			if encoding != test.wantEncoding {
+				t.Errorf("Metrics export failed, expected content encoding %v, got %v", test.wantEncoding, encoding)
+			}
+
+			body, _ := ioutil.ReadAll(r.Body)
+			payload, err := decompress(encoding, body)
+			if err != nil {
+				t.Errorf("Error decompressing %v payload: %v", encoding, err)
+				return
+			}
+
+			if _, err := DecodeServiceRequest(payload, ""); err != nil {
+				t.Errorf("Error decoding compressed payload: %v", err)
+			}
+		}))
+
+		exportHTTP := HTTP{
+			address:             server.URL,
+			compression:         ZstdCompression,
+			minCompressionBytes: test.minCompressionBytes,
+			client:              server.Client(),
+			config:              config,
+		}
+
+		if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+			t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestNewHTTPUnsupportedCompression(t *testing.T) {
+	if _, err := NewHTTPWithConfig(HTTPConfig{Compression: "lz4"}, config); err == nil {
+		t.Errorf("Expected error creating HTTP exporter with unsupported compression")
+	}
+}
+
+// roundTripCounter is a RoundTripper middleware counting the requests.
+type roundTripCounter struct {
+	next     http.RoundTripper
+	requests int
+}
+
+func (c *roundTripCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.next.RoundTrip(req)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	client, err := HTTPConfig{}.newClient()
+	if err != nil {
+		t.Fatalf("Error creating HTTP client: %v", err)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.Proxy == nil || transport == http.DefaultTransport {
+		t.Errorf("New HTTP client failed, expected a copy of the default transport, got %v", client.Transport)
+	}
+
+	if client.Timeout != defaultHTTPTimeout {
+		t.Errorf("New HTTP client failed, expected timeout %v, got %v", defaultHTTPTimeout, client.Timeout)
+	}
+
+	custom := &http.Client{}
+	if client, _ := (HTTPConfig{Client: custom}).newClient(); client != custom {
+		t.Errorf("New HTTP client failed, expected the configured client, got %v", client)
+	}
+
+	invalid := []HTTPConfig{
+		{Client: custom, Timeout: time.Second},
+		{Client: custom, Transport: http.DefaultTransport},
+		{Transport: http.DefaultTransport, TLS: &TLSConfig{}},
+	}
+
+	for _, httpConfig := range invalid {
+		if _, err := httpConfig.newClient(); err == nil {
+			t.Errorf("Expected error creating HTTP client with %+v", httpConfig)
+		}
+	}
+}
+
+func TestHTTPExportMetricsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	counter := &roundTripCounter{next: server.Client().Transport}
+	agent, err := NewHTTPWithConfig(HTTPConfig{
+		Address:   server.URL,
+		Transport: counter,
+		Timeout:   time.Second,
+	}, config)
+	if err != nil {
+		t.Fatalf("Error creating HTTP exporter: %v", err)
+	}
+	agent.Stop()
+
+	exportHTTP := agent.Exporter.(HTTP)
+	if exportHTTP.client.Timeout != time.Second {
+		t.Errorf("New HTTP failed, expected client timeout %v, got %v", time.Second, exportHTTP.client.Timeout)
+	}
+
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+	}
+
+	if counter.requests != 1 {
+		t.Errorf("Metrics export failed, expected 1 request through the transport, got %v", counter.requests)
+	}
+}
+
+// drainRecorder is a RoundTripper middleware recording whether
+// the response bodies were read to the end before being closed.
+type drainRecorder struct {
+	next    http.RoundTripper
+	drained []bool
+}
+
+func (d *drainRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := d.next.RoundTrip(req)
+	if err == nil {
+		resp.Body = &drainRecorderBody{ReadCloser: resp.Body, recorder: d}
+	}
+	return resp, err
+}
+
+type drainRecorderBody struct {
+	io.ReadCloser
+	recorder *drainRecorder
+	eof      bool
+}
+
+func (b *drainRecorderBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *drainRecorderBody) Close() error {
+	b.recorder.drained = append(b.recorder.drained, b.eof)
+	return b.ReadCloser.Close()
+}
+
+func TestHTTPExportMetricsDrainsResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"accepted":true}`))
+	}))
+	defer server.Close()
+
+	recorder := &drainRecorder{next: server.Client().Transport}
+	exportHTTP := HTTP{address: server.URL, client: &http.Client{Transport: recorder}, config: config}
+	if err := exportHTTP.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTP: %v", err)
+	}
+
+	// unread bodies keep their connection from being reused
+	if want := []bool{true}; !reflect.DeepEqual(want, recorder.drained) {
+		t.Errorf("Metrics export failed, expected the response to be drained, got %v", recorder.drained)
+	}
+}
+
+type requestIDKey struct{}
+
+func TestHTTPExportMetricsHeaders(t *testing.T) {
+	var mu sync.Mutex
+	received := []http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header)
+	}))
+	defer server.Close()
+
+	agent, err := NewHTTPWithConfig(HTTPConfig{
+		Address: server.URL,
+		HeaderProvider: func(ctx context.Context) map[string]string {
+			requestID, _ := ctx.Value(requestIDKey{}).(string)
+			return map[string]string{"X-Request-Id": requestID, "X-Tenant": "provided"}
+		},
+	}, config)
+	if err != nil {
+		t.Fatalf("Error creating HTTP exporter: %v", err)
+	}
+	agent.Stop()
+
+	// headers are changed while metrics are being exported
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			agent.AddHeader(map[string]string{"X-Tenant": "static", "X-Extra": "extra"})
+			agent.RemoveHeader("X-Extra")
+		}()
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), requestIDKey{}, "request")
+			if err := agent.Exporter.ExportMetrics(ctx, metrics); err != nil {
+				t.Errorf("Error Exporting Metrics to HTTP: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, header := range received {
+		if header.Get("X-Request-Id") != "request" {
+			t.Errorf("Metrics export failed, expected request ID header request, got %v", header.Get("X-Request-Id"))
+		}
+
+		// provided headers take precedence over the static ones
+		if got := header.Values("X-Tenant"); len(got) != 1 || got[0] != "provided" {
+			t.Errorf("Metrics export failed, expected tenant header provided, got %v", got)
+		}
+	}
+
+	if got := agent.Exporter.(HTTP).headers.values; len(got) != 2 || got["X-Tenant"] != "static" {
+		t.Errorf("Add header failed, expected Content-Type and X-Tenant headers, got %v", got)
+	}
+}
+
+func TestAddHeaderUnsupportedExporter(t *testing.T) {
+	agent := newExporterAgent(Stdout{}, config)
+	if err := agent.AddHeader(map[string]string{"key": "val"}); err == nil {
+		t.Errorf("Expected error adding headers to a non-HTTP exporter")
+	}
+}
@@ -0,0 +1,321 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+const (
+	// lines are batched into datagrams of at most this size over UDP
+	influxDBUDPPayloadBytes = 1400
+	influxDBDialTimeout     = 10 * time.Second
+)
+
+var (
+	influxDBMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	influxDBKeyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// InfluxDBConfig holds the configurations of an InfluxDB (or
+// Telegraf) endpoint. Network is "http" (the default), "tcp"
+// or "udp". Over HTTP, Address is the write endpoint's URL, such
+// as http://localhost:8086/api/v2/write?org=org&bucket=bucket,
+// and Token (if set) is sent as an Authorization header, otherwise
+// Username and Password are sent with basic auth. Over TCP and UDP,
+// Address is the socket's host:port.
+type InfluxDBConfig struct {
+	Network  string
+	Address  string
+	Token    string
+	Username string
+	Password string
+}
+
+// InfluxDB is an exporter that exports metrics in the
+// InfluxDB line protocol over HTTP or a raw socket.
+type InfluxDB struct {
+	influxDBConfig InfluxDBConfig
+	client         *http.Client
+	config         Config
+}
+
+// NewInfluxDB returns a new exporter agent with an InfluxDB exporter attached
+func NewInfluxDB(influxDBConfig InfluxDBConfig, config Config) (*ExporterAgent, error) {
+	switch influxDBConfig.Network {
+	case "":
+		influxDBConfig.Network = "http"
+	case "http", "tcp", "udp":
+	default:
+		return nil, errors.Errorf("Unsupported InfluxDB network %v", influxDBConfig.Network)
+	}
+
+	exporter := InfluxDB{
+		influxDBConfig: influxDBConfig,
+		client:         newDefaultHTTPClient(),
+		config:         config,
+	}
+
+	agent := newExporterAgent(exporter, exporter.config)
+	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
+		return nil, errors.Wrap(err, "Couldn't Start Exporter")
+	}
+
+	return agent, nil
+}
+
+// ExportMetrics converts the metrics to line protocol and
+// writes them to the InfluxDB endpoint.
+func (e InfluxDB) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	resource, err := TotDetector(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Error creating resource detector")
+	}
+
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	lines := []string{}
+	for _, d := range data {
+		if !filter.matches(d.Descriptor.Name) {
+			continue
+		}
+
+		metricLines, err := metricToLineProtocol(d, resource.Labels)
+		if err != nil {
+			return errors.Wrap(err, "Error converting metric to line protocol")
+		}
+
+		lines = append(lines, metricLines...)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	switch e.influxDBConfig.Network {
+	case "tcp", "udp":
+		err = e.writeSocket(ctx, lines)
+	default:
+		err = e.postMetrics(ctx, lines)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "Error sending metrics")
+	}
+
+	return nil
+}
+
+func (e InfluxDB) postMetrics(ctx context.Context, lines []string) error {
+	payload := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, "POST", e.influxDBConfig.Address, strings.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "Error creating POST request")
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.influxDBConfig.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.influxDBConfig.Token)
+	} else if e.influxDBConfig.Username != "" {
+		req.SetBasicAuth(e.influxDBConfig.Username, e.influxDBConfig.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Error sending request")
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("InfluxDB endpoint responded with status %v", resp.Status)
+	}
+
+	return nil
+}
+
+func (e InfluxDB) writeSocket(ctx context.Context, lines []string) error {
+	dialer := net.Dialer{Timeout: influxDBDialTimeout}
+	conn, err := dialer.DialContext(ctx, e.influxDBConfig.Network, e.influxDBConfig.Address)
+	if err != nil {
+		return errors.Wrap(err, "Error connecting to InfluxDB")
+	}
+	defer conn.Close()
+
+	// over TCP every line is written at once, over UDP
+	// each datagram holds as many whole lines as fit
+	maxBytes := 0
+	if e.influxDBConfig.Network == "udp" {
+		maxBytes = influxDBUDPPayloadBytes
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if maxBytes > 0 && buf.Len() > 0 && buf.Len()+len(line)+1 > maxBytes {
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				return errors.Wrap(err, "Error writing to InfluxDB")
+			}
+			buf.Reset()
+		}
+
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "Error writing to InfluxDB")
+	}
+
+	return nil
+}
+
+// influxDBField is a field key and its formatted value, which
+// is empty for NaN and infinite values.
+type influxDBField struct {
+	key   string
+	value string
+}
+
+// metricToLineProtocol converts every point of the metric to a line.
+// Numbers are written to the value field, distributions to the count,
+// sum and cumulative le_<bound> bucket fields, and summaries to the
+// count, sum and p<percentile> fields. NaN and infinite values, which
+// line protocol can't hold, are logged and skipped.
+func metricToLineProtocol(m *metricdata.Metric, resourceLabels map[string]string) ([]string, error) {
+	lines := []string{}
+	measurement := influxDBMeasurementEscaper.Replace(m.Descriptor.Name)
+
+	for _, ts := range m.TimeSeries {
+		tags := timeSeriesToInfluxDBTags(m, ts, resourceLabels)
+
+		for _, p := range ts.Points {
+			fields, err := pointToInfluxDBFields(p)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Error converting metric %v", m.Descriptor.Name))
+			}
+
+			// a single unsupported value would fail the whole batch
+			pairs := make([]string, 0, len(fields))
+			for _, f := range fields {
+				if f.value == "" {
+					log.Printf("Skipping field %v of metric %v, its value isn't finite", f.key, m.Descriptor.Name)
+					continue
+				}
+
+				pairs = append(pairs, influxDBKeyEscaper.Replace(f.key)+"="+f.value)
+			}
+
+			if len(pairs) == 0 {
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf("%v%v %v %v", measurement, tags, strings.Join(pairs, ","), p.Time.UnixNano()))
+		}
+	}
+
+	return lines, nil
+}
+
+func timeSeriesToInfluxDBTags(m *metricdata.Metric, ts *metricdata.TimeSeries, resourceLabels map[string]string) string {
+	tags := map[string]string{}
+	for k, v := range resourceLabels {
+		tags[k] = v
+	}
+
+	for i, lv := range ts.LabelValues {
+		if lv.Present && i < len(m.Descriptor.LabelKeys) {
+			tags[m.Descriptor.LabelKeys[i].Key] = lv.Value
+		}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		// line protocol doesn't allow empty tag values
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%v=%v", influxDBKeyEscaper.Replace(k), influxDBKeyEscaper.Replace(tags[k]))
+	}
+
+	return b.String()
+}
+
+func formatInfluxDBFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// influxDBFloatField returns the float field, without a value
+// if it's NaN or infinite.
+func influxDBFloatField(key string, v float64) influxDBField {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return influxDBField{key: key}
+	}
+
+	return influxDBField{key: key, value: formatInfluxDBFloat(v)}
+}
+
+func formatInfluxDBInt(v int64) string {
+	return strconv.FormatInt(v, 10) + "i"
+}
+
+func pointToInfluxDBFields(p metricdata.Point) ([]influxDBField, error) {
+	switch v := p.Value.(type) {
+	case int64:
+		return []influxDBField{{key: "value", value: formatInfluxDBInt(v)}}, nil
+	case float64:
+		return []influxDBField{influxDBFloatField("value", v)}, nil
+	case *metricdata.Distribution:
+		fields := []influxDBField{
+			{key: "count", value: formatInfluxDBInt(v.Count)},
+			influxDBFloatField("sum", v.Sum),
+		}
+
+		var bounds []float64
+		if v.BucketOptions != nil {
+			bounds = v.BucketOptions.Bounds
+		}
+
+		cumulative := int64(0)
+		for i, bucket := range v.Buckets {
+			if i >= len(bounds) {
+				break
+			}
+
+			cumulative += bucket.Count
+			fields = append(fields, influxDBField{key: "le_" + formatInfluxDBFloat(bounds[i]), value: formatInfluxDBInt(cumulative)})
+		}
+
+		return append(fields, influxDBField{key: "le_+Inf", value: formatInfluxDBInt(v.Count)}), nil
+	case *metricdata.Summary:
+		fields := []influxDBField{
+			{key: "count", value: formatInfluxDBInt(v.Count)},
+			influxDBFloatField("sum", v.Sum),
+		}
+
+		for _, percentile := range sortedPercentiles(v) {
+			fields = append(fields, influxDBFloatField("p"+formatInfluxDBFloat(percentile), v.Snapshot.Percentiles[percentile]))
+		}
+
+		return fields, nil
+	default:
+		return nil, errors.New("Unsupported value type")
+	}
+}
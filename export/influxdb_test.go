@@ -0,0 +1,170 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestMetricToLineProtocol(t *testing.T) {
+	escaped := renamed(metric, "bytes in,total")
+	escaped.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{
+			LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("a=b c")},
+			Points:      metric.TimeSeries[0].Points,
+		},
+	}
+
+	got, err := metricToLineProtocol(escaped, map[string]string{"host": "localhost"})
+	if err != nil {
+		t.Fatalf("Error converting metric to line protocol: %v", err)
+	}
+
+	want := fmt.Sprintf(`bytes\ in\,total,Key=a\=b\ c,host=localhost value=%vi %v`, intVal, timeNow.UnixNano())
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("Metric to line protocol failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestDistributionToLineProtocol(t *testing.T) {
+	got, err := metricToLineProtocol(distributionMetric, nil)
+	if err != nil {
+		t.Fatalf("Error converting metric to line protocol: %v", err)
+	}
+
+	want := fmt.Sprintf("metric count=30i,sum=450,le_10=10i,le_20=20i,le_30=30i,le_+Inf=30i %v", timeNow.UnixNano())
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("Metric to line protocol failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestNonFiniteToLineProtocol(t *testing.T) {
+	gauge := renamed(metric, "gauge")
+	gauge.Descriptor.Type = metricdata.TypeGaugeFloat64
+	gauge.Descriptor.LabelKeys = nil
+	gauge.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{
+			Points: []metricdata.Point{
+				metricdata.NewFloat64Point(timeNow, math.NaN()),
+				metricdata.NewFloat64Point(timeNow, 1.5),
+			},
+		},
+	}
+
+	distribution := distributionOf([]float64{10}, 5)
+	distribution.Sum = math.Inf(1)
+	latency := renamed(distributionMetric, "latency")
+	latency.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{Points: []metricdata.Point{metricdata.NewDistributionPoint(timeNow, distribution)}},
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	got := []string{}
+	for _, m := range []*metricdata.Metric{gauge, latency} {
+		lines, err := metricToLineProtocol(m, nil)
+		if err != nil {
+			t.Fatalf("Error converting metric to line protocol: %v", err)
+		}
+		got = append(got, lines...)
+	}
+	log.SetOutput(os.Stderr)
+
+	// line protocol has no NaN or infinite values, they're skipped
+	want := []string{
+		fmt.Sprintf("gauge value=1.5 %v", timeNow.UnixNano()),
+		fmt.Sprintf("latency count=1i,le_10=1i,le_+Inf=1i %v", timeNow.UnixNano()),
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Metric to line protocol failed, expected %v, got %v", want, got)
+	}
+
+	if !strings.Contains(logs.String(), "Skipping field sum of metric latency") {
+		t.Errorf("Metric to line protocol failed, expected the skipped field to be logged, got %v", logs.String())
+	}
+}
+
+func TestInfluxDBExportMetricsHTTP(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Token token" {
+			t.Errorf("InfluxDB export failed, expected token authorization, got %v", auth)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	exporter := InfluxDB{
+		influxDBConfig: InfluxDBConfig{Network: "http", Address: server.URL, Token: "token"},
+		client:         server.Client(),
+		config:         config,
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error exporting metrics to InfluxDB: %v", err)
+	}
+
+	if body := <-received; !strings.HasPrefix(body, dummyName+",") || !strings.HasSuffix(body, "\n") {
+		t.Errorf("InfluxDB export failed, got body %v", body)
+	}
+}
+
+func TestInfluxDBExportMetricsUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening on UDP: %v", err)
+	}
+	defer conn.Close()
+
+	exporter := InfluxDB{
+		influxDBConfig: InfluxDBConfig{Network: "udp", Address: conn.LocalAddr().String()},
+		config:         config,
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error exporting metrics to InfluxDB: %v", err)
+	}
+
+	buf := make([]byte, influxDBUDPPayloadBytes)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Error reading UDP datagram: %v", err)
+	}
+
+	if got := string(buf[:n]); !strings.HasPrefix(got, dummyName+",") {
+		t.Errorf("InfluxDB export failed, got datagram %v", got)
+	}
+}
+
+func TestNewInfluxDBUnsupportedNetwork(t *testing.T) {
+	if _, err := NewInfluxDB(InfluxDBConfig{Network: "smoke"}, config); err == nil {
+		t.Errorf("Expected error creating InfluxDB exporter with unsupported network")
+	}
+}
+
+func TestNewInfluxDBClient(t *testing.T) {
+	agent, err := NewInfluxDB(InfluxDBConfig{Address: "http://localhost:8086/api/v2/write"}, config)
+	if err != nil {
+		t.Fatalf("Error creating InfluxDB exporter: %v", err)
+	}
+	agent.Stop()
+
+	if timeout := agent.Exporter.(InfluxDB).client.Timeout; timeout != defaultHTTPTimeout {
+		t.Errorf("New InfluxDB failed, expected client timeout %v, got %v", defaultHTTPTimeout, timeout)
+	}
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+)
+
+// IntervalOverride defines a reporting period for the metrics whose
+// names match Filter, overriding the Config's reporting period.
+type IntervalOverride struct {
+	Filter                      string
+	ReportingPeriodMilliseconds int
+}
+
+type scheduledInterval struct {
+	filter *regexp.Regexp
+	period int
+	ticks  int64
+}
+
+// intervalScheduler wraps an exporter and only hands it the metrics that
+// are due on the current tick. Producers are still read once per tick of
+// the reporting period; overridden periods are rounded to a multiple of it.
+type intervalScheduler struct {
+	metricexport.Exporter
+	intervals []scheduledInterval
+
+	mu   sync.Mutex
+	tick int64
+}
+
+func newIntervalScheduler(exporter metricexport.Exporter, overrides []IntervalOverride) (*intervalScheduler, error) {
+	intervals := []scheduledInterval{}
+
+	for _, o := range overrides {
+		filter, err := regexp.Compile(o.Filter)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error compiling interval override filter %v", o.Filter))
+		}
+
+		if o.ReportingPeriodMilliseconds <= 0 {
+			return nil, errors.Errorf("Invalid reporting period %v for interval override %v", o.ReportingPeriodMilliseconds, o.Filter)
+		}
+
+		intervals = append(intervals, scheduledInterval{
+			filter: filter,
+			period: o.ReportingPeriodMilliseconds,
+			ticks:  1,
+		})
+	}
+
+	return &intervalScheduler{
+		Exporter:  exporter,
+		intervals: intervals,
+	}, nil
+}
+
+// setReportingPeriod converts every overridden period to a number of
+// ticks of the base reporting period.
+func (s *intervalScheduler) setReportingPeriod(reportingPeriodms int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.intervals {
+		ticks := int64(1)
+		if reportingPeriodms > 0 {
+			ticks = int64((s.intervals[i].period + reportingPeriodms/2) / reportingPeriodms)
+		}
+
+		if ticks < 1 {
+			ticks = 1
+		}
+
+		s.intervals[i].ticks = ticks
+	}
+}
+
+// ExportMetrics exports the metrics that are due on the current tick.
+// Metrics that don't match any override are due on every tick.
+func (s *intervalScheduler) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	s.mu.Lock()
+	tick := s.tick
+	s.tick++
+	s.mu.Unlock()
+
+	due := []*metricdata.Metric{}
+	for _, d := range data {
+		if s.isDue(d.Descriptor.Name, tick) {
+			due = append(due, d)
+		}
+	}
+
+	if len(due) == 0 {
+		return nil
+	}
+
+	return s.Exporter.ExportMetrics(ctx, due)
+}
+
+func (s *intervalScheduler) isDue(name string, tick int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, interval := range s.intervals {
+		if interval.filter.MatchString(name) {
+			return tick%interval.ticks == 0
+		}
+	}
+
+	return true
+}
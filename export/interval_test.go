@@ -0,0 +1,84 @@
+package export
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+type recordingExporter struct {
+	exported [][]*metricdata.Metric
+}
+
+func (r *recordingExporter) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	r.exported = append(r.exported, data)
+	return nil
+}
+
+func namedMetric(name string) *metricdata.Metric {
+	return &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{Name: name},
+	}
+}
+
+func TestIntervalSchedulerExportsDueMetrics(t *testing.T) {
+	recorder := &recordingExporter{}
+	scheduler, err := newIntervalScheduler(recorder, []IntervalOverride{
+		{Filter: `^slow_`, ReportingPeriodMilliseconds: 3000},
+	})
+	if err != nil {
+		t.Fatalf("Error creating interval scheduler: %v", err)
+	}
+	scheduler.setReportingPeriod(1000)
+
+	data := []*metricdata.Metric{namedMetric("fast_metric"), namedMetric("slow_metric")}
+	for i := 0; i < 4; i++ {
+		if err := scheduler.ExportMetrics(context.Background(), data); err != nil {
+			t.Fatalf("Error exporting metrics: %v", err)
+		}
+	}
+
+	want := []int{2, 1, 1, 2}
+	if len(recorder.exported) != len(want) {
+		t.Fatalf("Interval scheduler failed, expected %v exports, got %v", len(want), len(recorder.exported))
+	}
+
+	for i, exported := range recorder.exported {
+		if len(exported) != want[i] {
+			t.Errorf("Interval scheduler failed on tick %v, expected %v metrics, got %v", i, want[i], len(exported))
+		}
+	}
+}
+
+func TestIntervalSchedulerSkipsEmptyTicks(t *testing.T) {
+	recorder := &recordingExporter{}
+	scheduler, err := newIntervalScheduler(recorder, []IntervalOverride{
+		{Filter: `.*`, ReportingPeriodMilliseconds: 2000},
+	})
+	if err != nil {
+		t.Fatalf("Error creating interval scheduler: %v", err)
+	}
+	scheduler.setReportingPeriod(1000)
+
+	data := []*metricdata.Metric{namedMetric(dummyName)}
+	for i := 0; i < 2; i++ {
+		if err := scheduler.ExportMetrics(context.Background(), data); err != nil {
+			t.Fatalf("Error exporting metrics: %v", err)
+		}
+	}
+
+	if len(recorder.exported) != 1 {
+		t.Errorf("Interval scheduler failed, expected 1 export, got %v", len(recorder.exported))
+	}
+}
+
+func TestIntervalSchedulerInvalidOverride(t *testing.T) {
+	if _, err := newIntervalScheduler(&recordingExporter{}, []IntervalOverride{{Filter: `(`, ReportingPeriodMilliseconds: 1000}}); err == nil {
+		t.Errorf("Expected error for invalid override filter")
+	}
+
+	if _, err := newIntervalScheduler(&recordingExporter{}, []IntervalOverride{{Filter: `.*`}}); err == nil {
+		t.Errorf("Expected error for invalid override reporting period")
+	}
+}
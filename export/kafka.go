@@ -3,15 +3,17 @@ package export
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"sort"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/pkg/errors"
 	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 var (
@@ -35,11 +37,35 @@ var (
 	}
 )
 
-// TopicConfig holds the configurations for Topic info
+const (
+	// contentTypeHeader is the Kafka message header holding
+	// the media type of the message's payload.
+	contentTypeHeader = "content-type"
+	// messageTypeHeader is the Kafka message header holding the
+	// full name of the payload's protobuf message, which tells
+	// batched service requests from single metrics.
+	messageTypeHeader = "message-type"
+)
+
+// TopicConfig holds the configurations for Topic info.
+// SchemaRegistry, if set, frames the protobuf payloads in the
+// Schema Registry wire format.
 type TopicConfig struct {
-	Topic         string
-	NumPartitions int
-	NumReplicas   int
+	Topic          string
+	NumPartitions  int
+	NumReplicas    int
+	SchemaRegistry *SchemaRegistryConfig
+}
+
+// KafkaConfig holds the configurations of a Kafka exporter. Producer
+// holds the librdkafka configurations of the producer, and Topic the
+// topic the messages are produced to. Batched sends every export
+// cycle as ExportMetricsServiceRequest messages, like the HTTP
+// exporter, instead of a message per metric.
+type KafkaConfig struct {
+	Producer *kafka.ConfigMap
+	Topic    TopicConfig
+	Batched  bool
 }
 
 // Kafka is an exporter that exports metrics to a
@@ -49,6 +75,8 @@ type Kafka struct {
 	kafkaConfig         *kafka.ConfigMap
 	producer            *kafka.Producer
 	topicInfo           TopicConfig
+	batched             bool
+	schemaRegistry      *schemaRegistry
 	messageFlushTimeSec int
 	lastDroppedLogCount int
 	DroppedDelta        int
@@ -56,6 +84,24 @@ type Kafka struct {
 
 // NewKafka returns a new Kafka exporter
 func NewKafka(config Config, kafkaConfig *kafka.ConfigMap, topicInfo TopicConfig) (*ExporterAgent, error) {
+	return NewKafkaWithConfig(KafkaConfig{Producer: kafkaConfig, Topic: topicInfo}, config)
+}
+
+// NewKafkaWithConfig returns a new exporter agent with a
+// Kafka exporter configured by kafkaExporterConfig attached
+func NewKafkaWithConfig(kafkaExporterConfig KafkaConfig, config Config) (*ExporterAgent, error) {
+	kafkaConfig, topicInfo := kafkaExporterConfig.Producer, kafkaExporterConfig.Topic
+
+	if topicInfo.SchemaRegistry != nil && config.encoder() != ProtobufEncoder {
+		return nil, errors.New("Schema Registry framing requires protobuf encoded payloads")
+	}
+
+	// the framed bytes would be sent as data_base64 of a protobuf
+	// content type, which no deserializer understands
+	if topicInfo.SchemaRegistry != nil && config.CloudEvents.Mode == StructuredCloudEvents {
+		return nil, errors.New("Schema Registry framing can't be combined with structured CloudEvents")
+	}
+
 	if err := view.Register(messagesSentView, messagesDropedView); err != nil {
 		return nil, errors.Wrap(err, "Error registering views")
 	}
@@ -74,12 +120,17 @@ func NewKafka(config Config, kafkaConfig *kafka.ConfigMap, topicInfo TopicConfig
 		config:              config,
 		kafkaConfig:         kafkaConfig,
 		topicInfo:           topicInfo,
+		batched:             kafkaExporterConfig.Batched,
 		producer:            producer,
 		lastDroppedLogCount: 0,
 		messageFlushTimeSec: 15,
 	}
 
-	agent := newExporterAgent(kafka)
+	if topicInfo.SchemaRegistry != nil {
+		kafka.schemaRegistry = newSchemaRegistry(*topicInfo.SchemaRegistry, topicInfo.Topic)
+	}
+
+	agent := newExporterAgent(kafka, kafka.config)
 	if err := agent.Start(kafka.config.reportingPeriodMilliseconds); err != nil {
 		return agent, errors.Wrap(err, "Error starting exporter")
 	}
@@ -158,35 +209,36 @@ func (e Kafka) ExportMetrics(ctx context.Context, data []*metricdata.Metric) err
 		return errors.Wrap(err, "Error creating resource detector")
 	}
 
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	includeData := []*metricdata.Metric{}
 	for _, d := range data {
-		matched, err := regexp.Match(e.config.IncludeFilter, []byte(d.Descriptor.Name))
-		if err != nil {
-			return errors.Wrap(err, "Error matching regular expression")
+		if filter.matches(d.Descriptor.Name) {
+			includeData = append(includeData, d)
 		}
+	}
 
-		if matched {
-			d.Resource = resource
-			metricsRequestpb, err := metricToProto(d)
-			if err != nil {
-				return errors.Wrap(err, "Error converting metric to Proto")
-			}
-
-			payload, err := proto.Marshal(metricsRequestpb)
-			if err != nil {
-				return errors.Wrap(err, "Marshalling Error")
-			}
+	events, err := e.messagePayloads(includeData, resource)
+	if err != nil {
+		return err
+	}
 
-			err = e.producer.Produce(&kafka.Message{
-				TopicPartition: kafka.TopicPartition{
-					Topic:     &e.topicInfo.Topic,
-					Partition: kafka.PartitionAny,
-				},
-				Value: payload,
-			}, nil)
+	md := e.config.payloadDescriptor(e.batched)
+	for _, event := range events {
+		err = e.producer.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &e.topicInfo.Topic,
+				Partition: kafka.PartitionAny,
+			},
+			Value:   event.body,
+			Headers: messageHeaders(event, md),
+		}, nil)
 
-			if err != nil {
-				return errors.Wrap(err, "Error sending message with Producer")
-			}
+		if err != nil {
+			return errors.Wrap(err, "Error sending message with Producer")
 		}
 	}
 
@@ -198,6 +250,93 @@ func (e Kafka) ExportMetrics(ctx context.Context, data []*metricdata.Metric) err
 	return nil
 }
 
+// messagePayloads encodes the metrics into the messages to produce,
+// as service requests in batched mode and otherwise as one message
+// per metric, split under the config's MaxPayloadBytes.
+func (e Kafka) messagePayloads(ms []*metricdata.Metric, r *resource.Resource) ([]cloudEventPayload, error) {
+	encode := func(batch []*metricdata.Metric) (cloudEventPayload, error) {
+		return e.encodeMessage(batch, r)
+	}
+
+	if e.batched {
+		if len(ms) == 0 {
+			return nil, nil
+		}
+
+		return splitPayloads(ms, e.config.MaxPayloadBytes, encode)
+	}
+
+	events := []cloudEventPayload{}
+	for _, m := range ms {
+		// a metric too large for a message is split by time series
+		metricEvents, err := splitPayloads([]*metricdata.Metric{m}, e.config.MaxPayloadBytes, encode)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, metricEvents...)
+	}
+
+	return events, nil
+}
+
+// encodeMessage encodes the batch, or its single metric outside of
+// batched mode, into a message framed for the Schema Registry if one
+// is configured and wrapped in a CloudEvent, so that MaxPayloadBytes
+// caps the messages as they're produced.
+func (e Kafka) encodeMessage(batch []*metricdata.Metric, r *resource.Resource) (cloudEventPayload, error) {
+	var pb proto.Message
+	var err error
+	if e.batched {
+		pb, err = e.config.metricsToRequest(batch, r)
+	} else {
+		pb, err = e.config.metricToMessage(batch[0], r)
+	}
+	if err != nil {
+		return cloudEventPayload{}, errors.Wrap(err, "Error converting metric to Proto")
+	}
+
+	payload, err := e.config.encoder().Encode(pb)
+	if err != nil {
+		return cloudEventPayload{}, errors.Wrap(err, "Marshalling Error")
+	}
+
+	md := e.config.payloadDescriptor(e.batched)
+	if e.schemaRegistry != nil {
+		if payload, err = e.schemaRegistry.frame(md, payload); err != nil {
+			return cloudEventPayload{}, errors.Wrap(err, "Error framing payload for Schema Registry")
+		}
+	}
+
+	event, err := e.config.wrapCloudEvent(payload, r, md)
+	if err != nil {
+		return cloudEventPayload{}, errors.Wrap(err, "Error wrapping payload in CloudEvent")
+	}
+
+	return event, nil
+}
+
+// messageHeaders returns the content type and message type headers
+// of the message and, in binary mode, the ce_ prefixed event attributes.
+func messageHeaders(event cloudEventPayload, md protoreflect.MessageDescriptor) []kafka.Header {
+	headers := []kafka.Header{
+		{Key: contentTypeHeader, Value: []byte(event.contentType)},
+		{Key: messageTypeHeader, Value: []byte(md.FullName())},
+	}
+
+	keys := make([]string, 0, len(event.attributes))
+	for k := range event.attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		headers = append(headers, kafka.Header{Key: "ce_" + k, Value: []byte(event.attributes[k])})
+	}
+
+	return headers
+}
+
 func handleEvents(events chan kafka.Event) {
 	for e := range events {
 		switch ev := e.(type) {
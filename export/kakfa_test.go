@@ -13,6 +13,7 @@ import (
 	"github.com/docker/go-connections/nat"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"go.opencensus.io/metric/metricdata"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -175,6 +176,54 @@ func TestKafkaExportMetrics(t *testing.T) {
 	consumer.Close()
 }
 
+func TestKafkaMessagePayloads(t *testing.T) {
+	ms := []*metricdata.Metric{renamed(metric, "first"), renamed(metric, "second")}
+
+	perMetric := Kafka{config: config, topicInfo: topicInfo}
+	payloads, err := perMetric.messagePayloads(ms, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	if len(payloads) != len(ms) {
+		t.Fatalf("Kafka message payloads failed, expected %v messages, got %v", len(ms), len(payloads))
+	}
+
+	for i, payload := range payloads {
+		got, err := DecodeMetric(payload.body, "")
+		if err != nil {
+			t.Fatalf("Error decoding message payload: %v", err)
+		}
+
+		if got[0].Descriptor.Name != ms[i].Descriptor.Name {
+			t.Errorf("Kafka message payloads failed, expected metric %v, got %v", ms[i].Descriptor.Name, got[0].Descriptor.Name)
+		}
+	}
+
+	batched := Kafka{config: config, topicInfo: TopicConfig{Topic: topicName}, batched: true}
+	payloads, err = batched.messagePayloads(ms, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	if len(payloads) != 1 {
+		t.Fatalf("Kafka batched message payloads failed, expected 1 message, got %v", len(payloads))
+	}
+
+	got, err := DecodeServiceRequest(payloads[0].body, "")
+	if err != nil {
+		t.Fatalf("Error decoding message payload: %v", err)
+	}
+
+	if len(got) != len(ms) {
+		t.Errorf("Kafka batched message payloads failed, expected %v metrics, got %v", len(ms), len(got))
+	}
+
+	if payloads, _ := batched.messagePayloads(nil, nil); len(payloads) != 0 {
+		t.Errorf("Kafka batched message payloads failed, expected no message for an empty cycle, got %v", len(payloads))
+	}
+}
+
 func createDockerNetwork(t *testing.T, networkName string) (*client.Client, types.NetworkCreateResponse) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
@@ -281,7 +330,7 @@ func shutdownContainer(t *testing.T, container testcontainers.Container) {
 }
 
 func compareKafka(t *testing.T, want Kafka, got Kafka) {
-	if want.config != got.config {
+	if !reflect.DeepEqual(want.config, got.config) {
 		t.Errorf("New Kafka failed, expected config %v, got %v", want.config, got.config)
 	}
 
@@ -0,0 +1,325 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	instrumentationLibraryName = "github.com/confluentinc/telemetry-reporter-go"
+	// attribute holding the OpenCensus resource type, as named by the
+	// OpenTelemetry collector's OpenCensus translation
+	resourceTypeAttribute = "opencensus.resourcetype"
+)
+
+func metricsToOTLPServiceRequest(ms []*metricdata.Metric, r *resource.Resource) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	resourceMetrics := []*metricspb.ResourceMetrics{}
+	byResource := map[string]*metricspb.InstrumentationLibraryMetrics{}
+
+	for _, m := range ms {
+		toAppend, err := metricToOTLP(m)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error convert metric %v to OTLP proto", m))
+		}
+
+		metricResource := m.Resource
+		if metricResource == nil {
+			metricResource = r
+		}
+
+		key := resourceKey(metricResource)
+		libraryMetrics, ok := byResource[key]
+		if !ok {
+			libraryMetrics = &metricspb.InstrumentationLibraryMetrics{
+				InstrumentationLibrary: &commonpb.InstrumentationLibrary{
+					Name: instrumentationLibraryName,
+				},
+			}
+
+			byResource[key] = libraryMetrics
+			resourceMetrics = append(resourceMetrics, &metricspb.ResourceMetrics{
+				Resource:                      resourceToOTLP(metricResource),
+				InstrumentationLibraryMetrics: []*metricspb.InstrumentationLibraryMetrics{libraryMetrics},
+			})
+		}
+
+		libraryMetrics.Metrics = append(libraryMetrics.Metrics, toAppend)
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: resourceMetrics,
+	}, nil
+}
+
+// resourceKey identifies a resource by its type and labels, so that
+// equal resources held by different pointers are grouped together.
+func resourceKey(r *resource.Resource) string {
+	if r == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(r.Labels))
+	for k := range r.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q", r.Type)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q", k, r.Labels[k])
+	}
+
+	return b.String()
+}
+
+func resourceToOTLP(r *resource.Resource) *resourcepb.Resource {
+	if r == nil {
+		return nil
+	}
+
+	attributes := labelsToAttributes(r.Labels)
+	if r.Type != "" {
+		attributes = append(attributes, stringAttribute(resourceTypeAttribute, r.Type))
+	}
+
+	return &resourcepb.Resource{
+		Attributes: attributes,
+	}
+}
+
+func labelsToAttributes(labels map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := []*commonpb.KeyValue{}
+	for _, k := range keys {
+		attributes = append(attributes, stringAttribute(k, labels[k]))
+	}
+
+	return attributes
+}
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key: key,
+		Value: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: value},
+		},
+	}
+}
+
+func metricToOTLP(m *metricdata.Metric) (*metricspb.Metric, error) {
+	res := &metricspb.Metric{
+		Name:        m.Descriptor.Name,
+		Description: m.Descriptor.Description,
+		Unit:        string(m.Descriptor.Unit),
+	}
+
+	switch m.Descriptor.Type {
+	case metricdata.TypeGaugeInt64, metricdata.TypeGaugeFloat64:
+		points, err := metricToNumberDataPoints(m)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Data = &metricspb.Metric_Gauge{
+			Gauge: &metricspb.Gauge{DataPoints: points},
+		}
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+		points, err := metricToNumberDataPoints(m)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Data = &metricspb.Metric_Sum{
+			Sum: &metricspb.Sum{
+				DataPoints:             points,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			},
+		}
+	case metricdata.TypeCumulativeDistribution, metricdata.TypeGaugeDistribution:
+		points, err := metricToHistogramDataPoints(m)
+		if err != nil {
+			return nil, err
+		}
+
+		temporality := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		if m.Descriptor.Type == metricdata.TypeGaugeDistribution {
+			temporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		}
+
+		res.Data = &metricspb.Metric_Histogram{
+			Histogram: &metricspb.Histogram{
+				DataPoints:             points,
+				AggregationTemporality: temporality,
+			},
+		}
+	case metricdata.TypeSummary:
+		points, err := metricToSummaryDataPoints(m)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Data = &metricspb.Metric_Summary{
+			Summary: &metricspb.Summary{DataPoints: points},
+		}
+	default:
+		return nil, errors.New("Unsupported metric type")
+	}
+
+	return res, nil
+}
+
+func timeToUnixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return uint64(t.UnixNano())
+}
+
+func timeSeriesToAttributes(m *metricdata.Metric, ts *metricdata.TimeSeries) []*commonpb.KeyValue {
+	attributes := []*commonpb.KeyValue{}
+
+	for i, lv := range ts.LabelValues {
+		if !lv.Present || i >= len(m.Descriptor.LabelKeys) {
+			continue
+		}
+
+		attributes = append(attributes, stringAttribute(m.Descriptor.LabelKeys[i].Key, lv.Value))
+	}
+
+	return attributes
+}
+
+func metricToNumberDataPoints(m *metricdata.Metric) ([]*metricspb.NumberDataPoint, error) {
+	points := []*metricspb.NumberDataPoint{}
+
+	for _, ts := range m.TimeSeries {
+		attributes := timeSeriesToAttributes(m, ts)
+
+		for _, p := range ts.Points {
+			toAppend := &metricspb.NumberDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: timeToUnixNano(ts.StartTime),
+				TimeUnixNano:      timeToUnixNano(p.Time),
+			}
+
+			switch v := p.Value.(type) {
+			case int64:
+				toAppend.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v}
+			case float64:
+				toAppend.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+			default:
+				return nil, errors.New("Unsupported value type")
+			}
+
+			points = append(points, toAppend)
+		}
+	}
+
+	return points, nil
+}
+
+func metricToHistogramDataPoints(m *metricdata.Metric) ([]*metricspb.HistogramDataPoint, error) {
+	points := []*metricspb.HistogramDataPoint{}
+
+	for _, ts := range m.TimeSeries {
+		attributes := timeSeriesToAttributes(m, ts)
+
+		for _, p := range ts.Points {
+			v, ok := p.Value.(*metricdata.Distribution)
+			if !ok {
+				return nil, errors.New("Unsupported value type")
+			}
+
+			toAppend := &metricspb.HistogramDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: timeToUnixNano(ts.StartTime),
+				TimeUnixNano:      timeToUnixNano(p.Time),
+				Count:             uint64(v.Count),
+				Sum:               v.Sum,
+				BucketCounts:      []uint64{},
+				Exemplars:         []*metricspb.Exemplar{},
+			}
+
+			if v.BucketOptions != nil {
+				toAppend.ExplicitBounds = v.BucketOptions.Bounds
+			}
+
+			for _, b := range v.Buckets {
+				toAppend.BucketCounts = append(toAppend.BucketCounts, uint64(b.Count))
+
+				if b.Exemplar != nil {
+					toAppend.Exemplars = append(toAppend.Exemplars, exemplarToOTLP(b.Exemplar))
+				}
+			}
+
+			points = append(points, toAppend)
+		}
+	}
+
+	return points, nil
+}
+
+func exemplarToOTLP(e *metricdata.Exemplar) *metricspb.Exemplar {
+	attachments := map[string]string{}
+	for k, v := range e.Attachments {
+		attachments[k] = fmt.Sprintf("%v", v)
+	}
+
+	return &metricspb.Exemplar{
+		FilteredAttributes: labelsToAttributes(attachments),
+		TimeUnixNano:       timeToUnixNano(e.Timestamp),
+		Value:              &metricspb.Exemplar_AsDouble{AsDouble: e.Value},
+	}
+}
+
+func metricToSummaryDataPoints(m *metricdata.Metric) ([]*metricspb.SummaryDataPoint, error) {
+	points := []*metricspb.SummaryDataPoint{}
+
+	for _, ts := range m.TimeSeries {
+		attributes := timeSeriesToAttributes(m, ts)
+
+		for _, p := range ts.Points {
+			v, ok := p.Value.(*metricdata.Summary)
+			if !ok {
+				return nil, errors.New("Unsupported value type")
+			}
+
+			quantiles := []*metricspb.SummaryDataPoint_ValueAtQuantile{}
+			for _, percentile := range sortedPercentiles(v) {
+				quantiles = append(quantiles, &metricspb.SummaryDataPoint_ValueAtQuantile{
+					Quantile: percentile / 100,
+					Value:    v.Snapshot.Percentiles[percentile],
+				})
+			}
+
+			points = append(points, &metricspb.SummaryDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: timeToUnixNano(ts.StartTime),
+				TimeUnixNano:      timeToUnixNano(p.Time),
+				Count:             uint64(v.Count),
+				Sum:               v.Sum,
+				QuantileValues:    quantiles,
+			})
+		}
+	}
+
+	return points, nil
+}
@@ -0,0 +1,144 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var (
+	attributesOTLP = []*commonpb.KeyValue{stringAttribute(dummyLabelKey, dummyLabelVal)}
+
+	summaryMetric = &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name: dummyName,
+			Type: metricdata.TypeSummary,
+		},
+		TimeSeries: []*metricdata.TimeSeries{
+			&metricdata.TimeSeries{
+				Points: []metricdata.Point{metricdata.NewSummaryPoint(timeNow, &metricdata.Summary{
+					Count:          intVal,
+					Sum:            doubleVal,
+					HasCountAndSum: true,
+					Snapshot: metricdata.Snapshot{
+						Percentiles: map[float64]float64{99: 2, 50: 1},
+					},
+				})},
+				StartTime: timeNow,
+			},
+		},
+	}
+)
+
+func TestMetricToOTLPSum(t *testing.T) {
+	got, err := metricToOTLP(metric)
+	if err != nil {
+		t.Fatalf("Error converting metric to OTLP: %v", err)
+	}
+
+	want := &metricspb.Sum{
+		DataPoints: []*metricspb.NumberDataPoint{
+			&metricspb.NumberDataPoint{
+				Attributes:        attributesOTLP,
+				StartTimeUnixNano: uint64(timeNow.UnixNano()),
+				TimeUnixNano:      uint64(timeNow.UnixNano()),
+				Value:             &metricspb.NumberDataPoint_AsInt{AsInt: intVal},
+			},
+		},
+		AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		IsMonotonic:            true,
+	}
+
+	if got.Name != dummyName || got.Description != dummyDesc || got.Unit != dummyUnit {
+		t.Errorf("Metric to OTLP failed, got %v", got)
+	}
+
+	if !reflect.DeepEqual(want, got.GetSum()) {
+		t.Errorf("Metric to OTLP failed, expected %v, got %v", want, got.GetSum())
+	}
+}
+
+func TestMetricToOTLPHistogram(t *testing.T) {
+	got, err := metricToOTLP(distributionMetric)
+	if err != nil {
+		t.Fatalf("Error converting metric to OTLP: %v", err)
+	}
+
+	histogram := got.GetHistogram()
+	if histogram == nil || len(histogram.DataPoints) != 1 {
+		t.Fatalf("Metric to OTLP failed, expected a histogram point, got %v", got)
+	}
+
+	point := histogram.DataPoints[0]
+	if point.Count != uint64(summaryDistribution.Count) || point.Sum != summaryDistribution.Sum {
+		t.Errorf("Metric to OTLP failed, expected count %v and sum %v, got %v and %v",
+			summaryDistribution.Count, summaryDistribution.Sum, point.Count, point.Sum)
+	}
+
+	if !reflect.DeepEqual(point.BucketCounts, []uint64{10, 10, 10, 0}) ||
+		!reflect.DeepEqual(point.ExplicitBounds, summaryDistribution.BucketOptions.Bounds) {
+		t.Errorf("Metric to OTLP failed, got buckets %v with bounds %v", point.BucketCounts, point.ExplicitBounds)
+	}
+}
+
+func TestMetricToOTLPSummary(t *testing.T) {
+	got, err := metricToOTLP(summaryMetric)
+	if err != nil {
+		t.Fatalf("Error converting metric to OTLP: %v", err)
+	}
+
+	want := []*metricspb.SummaryDataPoint_ValueAtQuantile{
+		{Quantile: 0.5, Value: 1},
+		{Quantile: 0.99, Value: 2},
+	}
+
+	point := got.GetSummary().DataPoints[0]
+	if !reflect.DeepEqual(want, point.QuantileValues) {
+		t.Errorf("Metric to OTLP failed, expected quantiles %v, got %v", want, point.QuantileValues)
+	}
+}
+
+func TestMetricsToOTLPServiceRequest(t *testing.T) {
+	res := &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "localhost"}}
+	withResource := *metric
+	withResource.Resource = res
+
+	// an equal resource held by another pointer shares the resource metrics
+	withEqualResource := *metric
+	withEqualResource.Resource = &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "localhost"}}
+
+	withOtherResource := *metric
+	withOtherResource.Resource = &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "remote"}}
+
+	got, err := Config{PayloadFormat: OTLPFormat}.metricsToRequest([]*metricdata.Metric{&withResource, &withOtherResource, &withEqualResource}, nil)
+	if err != nil {
+		t.Fatalf("Error converting metrics to OTLP request: %v", err)
+	}
+
+	request, ok := got.(*colmetricspb.ExportMetricsServiceRequest)
+	if !ok {
+		t.Fatalf("Metrics to request failed, expected OTLP request, got %T", got)
+	}
+
+	if len(request.ResourceMetrics) != 2 {
+		t.Fatalf("Metrics to OTLP request failed, expected 2 resources, got %v", len(request.ResourceMetrics))
+	}
+
+	wantResource := []*commonpb.KeyValue{
+		stringAttribute("host.hostname", "localhost"),
+		stringAttribute(resourceTypeAttribute, "host"),
+	}
+	if !reflect.DeepEqual(wantResource, request.ResourceMetrics[0].Resource.Attributes) {
+		t.Errorf("Metrics to OTLP request failed, expected resource %v, got %v", wantResource, request.ResourceMetrics[0].Resource.Attributes)
+	}
+
+	library := request.ResourceMetrics[0].InstrumentationLibraryMetrics[0]
+	if library.InstrumentationLibrary.Name != instrumentationLibraryName || len(library.Metrics) != 2 {
+		t.Errorf("Metrics to OTLP request failed, got %v", library)
+	}
+}
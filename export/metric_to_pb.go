@@ -2,18 +2,30 @@ package export
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"time"
 
+	c1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	a1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
 	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
 	r1 "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/pkg/errors"
+	"go.opencensus.io"
 	"go.opencensus.io/metric/metricdata"
 	"go.opencensus.io/resource"
 )
 
-func metricsToServiceRequest(ms []*metricdata.Metric) (*a1.ExportMetricsServiceRequest, error) {
+// processStartTime approximates the start time of the process
+// for the Node identifier sent with every request.
+var processStartTime = time.Now()
+
+// metricsToServiceRequest converts the metrics to a request carrying
+// the Node and Resource once. Metrics only carry their own resource
+// when it differs from the request's.
+func metricsToServiceRequest(ms []*metricdata.Metric, r *resource.Resource) (*a1.ExportMetricsServiceRequest, error) {
 	metrics := []*v1.Metric{}
 
 	for _, m := range ms {
@@ -23,14 +35,45 @@ func metricsToServiceRequest(ms []*metricdata.Metric) (*a1.ExportMetricsServiceR
 			return nil, errors.Wrap(err, fmt.Sprintf("Error convert metric %v to proto", m))
 		}
 
+		if m.Resource == nil || equalResources(m.Resource, r) {
+			toAppend.Resource = nil
+		}
+
 		metrics = append(metrics, toAppend)
 	}
 
 	return &a1.ExportMetricsServiceRequest{
-		Metrics: metrics,
+		Node:     nodeProto(),
+		Resource: resourceToProto(r),
+		Metrics:  metrics,
 	}, nil
 }
 
+func nodeProto() *c1.Node {
+	hostname, _ := os.Hostname()
+	startTimestamp, _ := ptypes.TimestampProto(processStartTime)
+
+	return &c1.Node{
+		Identifier: &c1.ProcessIdentifier{
+			HostName:       hostname,
+			Pid:            uint32(os.Getpid()),
+			StartTimestamp: startTimestamp,
+		},
+		LibraryInfo: &c1.LibraryInfo{
+			Language:           c1.LibraryInfo_GO_LANG,
+			CoreLibraryVersion: opencensus.Version(),
+		},
+	}
+}
+
+func equalResources(a *resource.Resource, b *resource.Resource) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Type == b.Type && reflect.DeepEqual(a.Labels, b.Labels)
+}
+
 func metricToProto(m *metricdata.Metric) (*v1.Metric, error) {
 	timeseries, err := metricToTimeSeries(m)
 
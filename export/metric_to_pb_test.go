@@ -1,12 +1,14 @@
 package export
 
 import (
+	"os"
 	"reflect"
 	"testing"
 
 	"go.opencensus.io/metric/metricdata"
 	"go.opencensus.io/resource"
 
+	c1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	a1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
 	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
 	r1 "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
@@ -190,7 +192,7 @@ func TestMetricToProto(t *testing.T) {
 }
 
 func TestMetricToServiceRequest(t *testing.T) {
-	got, err := metricsToServiceRequest(metrics)
+	got, err := metricsToServiceRequest(metrics, nil)
 	if err != nil {
 		t.Fatalf("Error converting metrics to service proto: %v", err)
 	}
@@ -200,6 +202,42 @@ func TestMetricToServiceRequest(t *testing.T) {
 	}
 }
 
+func TestMetricToServiceRequestResource(t *testing.T) {
+	requestResource := &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "localhost"}}
+	sameResource := &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "localhost"}}
+	otherResource := &resource.Resource{Type: "container", Labels: map[string]string{"container.name": "broker"}}
+
+	withSame, withOther := *metric, *metric
+	withSame.Resource = sameResource
+	withOther.Resource = otherResource
+
+	got, err := metricsToServiceRequest([]*metricdata.Metric{metric, &withSame, &withOther}, requestResource)
+	if err != nil {
+		t.Fatalf("Error converting metrics to service proto: %v", err)
+	}
+
+	if !reflect.DeepEqual(resourceToProto(requestResource), got.Resource) {
+		t.Errorf("Metric to service request failed, expected resource %v, got %v", requestResource, got.Resource)
+	}
+
+	if got.Metrics[0].Resource != nil || got.Metrics[1].Resource != nil {
+		t.Errorf("Metric to service request failed, expected metrics without resource, got %v and %v", got.Metrics[0].Resource, got.Metrics[1].Resource)
+	}
+
+	if !reflect.DeepEqual(resourceToProto(otherResource), got.Metrics[2].Resource) {
+		t.Errorf("Metric to service request failed, expected resource %v, got %v", otherResource, got.Metrics[2].Resource)
+	}
+
+	identifier := got.GetNode().GetIdentifier()
+	if identifier.GetPid() != uint32(os.Getpid()) || identifier.GetStartTimestamp() == nil {
+		t.Errorf("Metric to service request failed, got node identifier %v", identifier)
+	}
+
+	if language := got.GetNode().GetLibraryInfo().GetLanguage(); language != c1.LibraryInfo_GO_LANG {
+		t.Errorf("Metric to service request failed, expected language %v, got %v", c1.LibraryInfo_GO_LANG, language)
+	}
+}
+
 func comparePoints(t *testing.T, want []*v1.Point, got []*v1.Point) {
 	if len(want) != len(got) {
 		t.Fatalf("Metric to Points int failed, expected length %v, got %v", len(want), len(got))
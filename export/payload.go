@@ -0,0 +1,151 @@
+package export
+
+import (
+	a1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// PayloadFormat selects the protobuf schema of the
+// payloads sent by the HTTP and Kafka exporters.
+type PayloadFormat int
+
+const (
+	// OpenCensusFormat sends OpenCensus ExportMetricsServiceRequests,
+	// or a single OpenCensus Metric per Kafka message.
+	OpenCensusFormat PayloadFormat = iota
+	// OTLPFormat sends OpenTelemetry ExportMetricsServiceRequests.
+	OTLPFormat
+)
+
+// metricsToRequest converts the metrics to a service request of the
+// config's payload format. Metrics without a resource are reported
+// under the given resource.
+func (c Config) metricsToRequest(ms []*metricdata.Metric, r *resource.Resource) (proto.Message, error) {
+	if c.PayloadFormat == OTLPFormat {
+		return metricsToOTLPServiceRequest(ms, r)
+	}
+
+	return metricsToServiceRequest(ms, r)
+}
+
+// metricToMessage converts a single metric to the message
+// sent by exporters that send one message per metric.
+func (c Config) metricToMessage(m *metricdata.Metric, r *resource.Resource) (proto.Message, error) {
+	if c.PayloadFormat == OTLPFormat {
+		return metricsToOTLPServiceRequest([]*metricdata.Metric{m}, r)
+	}
+
+	// a lone metric has no request to carry the resource
+	if m.Resource == nil {
+		withResource := *m
+		withResource.Resource = r
+		m = &withResource
+	}
+
+	return metricToProto(m)
+}
+
+// splitPayloads encodes the metrics into the payloads to send, halving
+// the batches whose final body exceeds maxBytes first at metric boundaries and then at time series
+// boundaries. A single time series can't be split and is encoded as is,
+// even if it's larger than maxBytes.
+func splitPayloads(ms []*metricdata.Metric, maxBytes int, encode func([]*metricdata.Metric) (cloudEventPayload, error)) ([]cloudEventPayload, error) {
+	payload, err := encode(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBytes <= 0 || len(payload.body) <= maxBytes {
+		return []cloudEventPayload{payload}, nil
+	}
+
+	var left, right []*metricdata.Metric
+	switch {
+	case len(ms) > 1:
+		left, right = ms[:len(ms)/2], ms[len(ms)/2:]
+	case len(ms) == 1 && len(ms[0].TimeSeries) > 1:
+		half := len(ms[0].TimeSeries) / 2
+		leftMetric, rightMetric := *ms[0], *ms[0]
+		leftMetric.TimeSeries = ms[0].TimeSeries[:half]
+		rightMetric.TimeSeries = ms[0].TimeSeries[half:]
+		left, right = []*metricdata.Metric{&leftMetric}, []*metricdata.Metric{&rightMetric}
+	default:
+		return []cloudEventPayload{payload}, nil
+	}
+
+	leftPayloads, err := splitPayloads(left, maxBytes, encode)
+	if err != nil {
+		return nil, err
+	}
+
+	rightPayloads, err := splitPayloads(right, maxBytes, encode)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(leftPayloads, rightPayloads...), nil
+}
+
+// payloadDescriptor returns the descriptor of the payloads of the
+// config's format, sent in batches or as one message per metric.
+func (c Config) payloadDescriptor(batched bool) protoreflect.MessageDescriptor {
+	if c.PayloadFormat == OTLPFormat {
+		return (&colmetricspb.ExportMetricsServiceRequest{}).ProtoReflect().Descriptor()
+	}
+
+	if batched {
+		return (&a1.ExportMetricsServiceRequest{}).ProtoReflect().Descriptor()
+	}
+
+	return (&v1.Metric{}).ProtoReflect().Descriptor()
+}
+
+// Encoder serializes the request protobufs into the
+// payloads sent by the HTTP and Kafka exporters.
+type Encoder interface {
+	Encode(m proto.Message) ([]byte, error)
+	// ContentType is the media type of the encoded payloads.
+	ContentType() string
+}
+
+var (
+	// ProtobufEncoder encodes payloads in the protobuf binary format.
+	ProtobufEncoder Encoder = protobufEncoder{}
+	// JSONEncoder encodes payloads in the canonical protobuf JSON mapping.
+	JSONEncoder Encoder = jsonEncoder{}
+)
+
+type protobufEncoder struct{}
+
+func (protobufEncoder) Encode(m proto.Message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (protobufEncoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(m proto.Message) ([]byte, error) {
+	return protojson.Marshal(m)
+}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+// encoder returns the config's Encoder, defaulting to protobuf.
+func (c Config) encoder() Encoder {
+	if c.Encoder == nil {
+		return ProtobufEncoder
+	}
+
+	return c.Encoder
+}
@@ -0,0 +1,126 @@
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	"go.opencensus.io/metric/metricdata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncoders(t *testing.T) {
+	want, err := metricToProto(metric)
+	if err != nil {
+		t.Fatalf("Error converting metric to Proto: %v", err)
+	}
+
+	for _, encoder := range []Encoder{ProtobufEncoder, JSONEncoder} {
+		payload, err := encoder.Encode(want)
+		if err != nil {
+			t.Fatalf("Error encoding %v payload: %v", encoder.ContentType(), err)
+		}
+
+		got := &v1.Metric{}
+		unmarshal := proto.Unmarshal
+		if encoder == JSONEncoder {
+			unmarshal = protojson.Unmarshal
+		}
+
+		if err := unmarshal(payload, got); err != nil {
+			t.Fatalf("Error decoding %v payload: %v", encoder.ContentType(), err)
+		}
+
+		if !proto.Equal(want, got) {
+			t.Errorf("Encoding %v payload failed, expected %v, got %v", encoder.ContentType(), want, got)
+		}
+	}
+}
+
+func TestConfigEncoderDefault(t *testing.T) {
+	if got := (Config{}).encoder(); got != ProtobufEncoder {
+		t.Errorf("Config encoder failed, expected protobuf encoder, got %v", got)
+	}
+}
+
+func TestSplitPayloads(t *testing.T) {
+	series := []*metricdata.TimeSeries{}
+	for i := 0; i < 8; i++ {
+		series = append(series, partitionedSeries("topic", fmt.Sprint(i), metricdata.NewInt64Point(timeNow, int64(i))))
+	}
+	large := partitionedMetric(metricdata.TypeGaugeInt64, series...)
+	ms := []*metricdata.Metric{renamed(metric, "first"), renamed(metric, "second"), large}
+
+	encode := func(batch []*metricdata.Metric) (cloudEventPayload, error) {
+		request, err := metricsToServiceRequest(batch, nil)
+		if err != nil {
+			return cloudEventPayload{}, err
+		}
+
+		body, err := proto.Marshal(request)
+		return cloudEventPayload{body: body}, err
+	}
+
+	whole, err := encode(ms)
+	if err != nil {
+		t.Fatalf("Error encoding metrics: %v", err)
+	}
+
+	single, err := encode([]*metricdata.Metric{partitionedMetric(metricdata.TypeGaugeInt64, series[:2]...)})
+	if err != nil {
+		t.Fatalf("Error encoding metrics: %v", err)
+	}
+
+	maxBytes := len(single.body)
+	payloads, err := splitPayloads(ms, maxBytes, encode)
+	if err != nil {
+		t.Fatalf("Error splitting payloads: %v", err)
+	}
+
+	if len(payloads) < 2 || len(whole.body) <= maxBytes {
+		t.Fatalf("Split payloads failed, expected payload of %v bytes to be split, got %v payloads", len(whole.body), len(payloads))
+	}
+
+	names := []string{}
+	timeSeries := 0
+	for _, payload := range payloads {
+		if len(payload.body) > maxBytes {
+			t.Errorf("Split payloads failed, expected at most %v bytes, got %v", maxBytes, len(payload.body))
+		}
+
+		decoded, err := DecodeServiceRequest(payload.body, "")
+		if err != nil {
+			t.Fatalf("Error decoding payload: %v", err)
+		}
+
+		for _, m := range decoded {
+			if len(names) == 0 || names[len(names)-1] != m.Descriptor.Name {
+				names = append(names, m.Descriptor.Name)
+			}
+			timeSeries += len(m.TimeSeries)
+		}
+	}
+
+	if want := []string{"first", "second", dummyName}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Split payloads failed, expected metrics %v, got %v", want, names)
+	}
+
+	if want := 2 + len(series); timeSeries != want {
+		t.Errorf("Split payloads failed, expected %v time series, got %v", want, timeSeries)
+	}
+}
+
+func TestSplitPayloadsUnlimited(t *testing.T) {
+	payloads, err := splitPayloads(metrics, 0, func(batch []*metricdata.Metric) (cloudEventPayload, error) {
+		return cloudEventPayload{body: make([]byte, 100)}, nil
+	})
+	if err != nil {
+		t.Fatalf("Error splitting payloads: %v", err)
+	}
+
+	if len(payloads) != 1 {
+		t.Errorf("Split payloads failed, expected 1 payload, got %v", len(payloads))
+	}
+}
@@ -0,0 +1,268 @@
+package export
+
+import (
+	"fmt"
+	"time"
+
+	a1 "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	r1 "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DecodeServiceRequest decodes the payload of an OpenCensus
+// ExportMetricsServiceRequest, as sent by the HTTP exporter, back
+// into metrics. contentType is the payload's media type, the
+// protobuf binary format is assumed if it is empty. Metrics without
+// a resource of their own are given the request's resource.
+func DecodeServiceRequest(payload []byte, contentType string) ([]*metricdata.Metric, error) {
+	request := &a1.ExportMetricsServiceRequest{}
+	if err := unmarshalPayload(payload, contentType, request); err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling service request")
+	}
+
+	return serviceRequestToMetrics(request)
+}
+
+// DecodeMetric decodes the payload of an OpenCensus Metric, as
+// produced by the Kafka exporter, back into metrics. contentType
+// is the payload's media type, the protobuf binary format is
+// assumed if it is empty.
+func DecodeMetric(payload []byte, contentType string) ([]*metricdata.Metric, error) {
+	pb := &v1.Metric{}
+	if err := unmarshalPayload(payload, contentType, pb); err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling metric")
+	}
+
+	m, err := protoToMetric(pb, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error converting proto %v to metric", pb.GetMetricDescriptor().GetName()))
+	}
+
+	return []*metricdata.Metric{m}, nil
+}
+
+func unmarshalPayload(payload []byte, contentType string, m proto.Message) error {
+	switch contentType {
+	case "", ProtobufEncoder.ContentType():
+		return proto.Unmarshal(payload, m)
+	case JSONEncoder.ContentType():
+		return protojson.Unmarshal(payload, m)
+	default:
+		return errors.Errorf("Unsupported content type %v", contentType)
+	}
+}
+
+func serviceRequestToMetrics(request *a1.ExportMetricsServiceRequest) ([]*metricdata.Metric, error) {
+	requestResource := protoToResource(request.GetResource())
+	ms := []*metricdata.Metric{}
+
+	for _, pb := range request.GetMetrics() {
+		m, err := protoToMetric(pb, requestResource)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error converting proto %v to metric", pb.GetMetricDescriptor().GetName()))
+		}
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
+
+// protoToMetric is the inverse of metricToProto. The metric is
+// given the default resource if it doesn't carry one.
+func protoToMetric(pb *v1.Metric, defaultResource *resource.Resource) (*metricdata.Metric, error) {
+	descriptor, err := protoToDescriptor(pb.GetMetricDescriptor())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &metricdata.Metric{
+		Descriptor: descriptor,
+		TimeSeries: []*metricdata.TimeSeries{},
+		Resource:   protoToResource(pb.GetResource()),
+	}
+
+	if m.Resource == nil {
+		m.Resource = defaultResource
+	}
+
+	for _, ts := range pb.GetTimeseries() {
+		timeSeries, err := protoToTimeSeries(ts)
+		if err != nil {
+			return nil, err
+		}
+
+		m.TimeSeries = append(m.TimeSeries, timeSeries)
+	}
+
+	return m, nil
+}
+
+func protoToDescriptor(pb *v1.MetricDescriptor) (metricdata.Descriptor, error) {
+	if pb.GetType() == v1.MetricDescriptor_UNSPECIFIED {
+		return metricdata.Descriptor{}, errors.New("Unspecified metric type")
+	}
+
+	labelKeys := []metricdata.LabelKey{}
+	for _, lk := range pb.GetLabelKeys() {
+		labelKeys = append(labelKeys, metricdata.LabelKey{
+			Key:         lk.GetKey(),
+			Description: lk.GetDescription(),
+		})
+	}
+
+	return metricdata.Descriptor{
+		Name:        pb.GetName(),
+		Description: pb.GetDescription(),
+		Unit:        metricdata.Unit(pb.GetUnit()),
+		Type:        protoTypeToMetricdataType(pb.GetType()),
+		LabelKeys:   labelKeys,
+	}, nil
+}
+
+// protoTypeToMetricdataType is the inverse of metricdataTypetoProtoType.
+func protoTypeToMetricdataType(protoType v1.MetricDescriptor_Type) metricdata.Type {
+	return metricdata.Type(protoType - 1)
+}
+
+func protoToResource(pb *r1.Resource) *resource.Resource {
+	if pb == nil {
+		return nil
+	}
+
+	return &resource.Resource{
+		Type:   pb.GetType(),
+		Labels: pb.GetLabels(),
+	}
+}
+
+func protoToTime(pb *timestamppb.Timestamp) (time.Time, error) {
+	if pb == nil {
+		return time.Time{}, nil
+	}
+
+	return ptypes.Timestamp(pb)
+}
+
+func protoToTimeSeries(pb *v1.TimeSeries) (*metricdata.TimeSeries, error) {
+	startTime, err := protoToTime(pb.GetStartTimestamp())
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid start timestamp")
+	}
+
+	ts := &metricdata.TimeSeries{
+		LabelValues: []metricdata.LabelValue{},
+		Points:      []metricdata.Point{},
+		StartTime:   startTime,
+	}
+
+	for _, lv := range pb.GetLabelValues() {
+		ts.LabelValues = append(ts.LabelValues, metricdata.LabelValue{
+			Value:   lv.GetValue(),
+			Present: lv.GetHasValue(),
+		})
+	}
+
+	for _, p := range pb.GetPoints() {
+		point, err := protoToPoint(p)
+		if err != nil {
+			return nil, err
+		}
+
+		ts.Points = append(ts.Points, point)
+	}
+
+	return ts, nil
+}
+
+func protoToPoint(pb *v1.Point) (metricdata.Point, error) {
+	t, err := protoToTime(pb.GetTimestamp())
+	if err != nil {
+		return metricdata.Point{}, errors.Wrap(err, "Invalid point timestamp")
+	}
+
+	switch v := pb.GetValue().(type) {
+	case *v1.Point_Int64Value:
+		return metricdata.NewInt64Point(t, v.Int64Value), nil
+	case *v1.Point_DoubleValue:
+		return metricdata.NewFloat64Point(t, v.DoubleValue), nil
+	case *v1.Point_DistributionValue:
+		distribution, err := protoToDistribution(v.DistributionValue)
+		if err != nil {
+			return metricdata.Point{}, err
+		}
+		return metricdata.NewDistributionPoint(t, distribution), nil
+	case *v1.Point_SummaryValue:
+		return metricdata.NewSummaryPoint(t, protoToSummary(v.SummaryValue)), nil
+	default:
+		return metricdata.Point{}, errors.New("Unsupported value type")
+	}
+}
+
+// protoToSummary is the inverse of pointToSummaryValue, which only
+// sends the snapshot's count and sum when HasCountAndSum is set.
+func protoToSummary(pb *v1.SummaryValue) *metricdata.Summary {
+	snapshot := pb.GetSnapshot()
+	summary := &metricdata.Summary{
+		Count:          pb.GetCount().GetValue(),
+		Sum:            pb.GetSum().GetValue(),
+		HasCountAndSum: snapshot.GetCount() != nil || snapshot.GetSum() != nil,
+		Snapshot: metricdata.Snapshot{
+			Count:       snapshot.GetCount().GetValue(),
+			Sum:         snapshot.GetSum().GetValue(),
+			Percentiles: map[float64]float64{},
+		},
+	}
+
+	for _, pv := range snapshot.GetPercentileValues() {
+		summary.Snapshot.Percentiles[pv.GetPercentile()] = pv.GetValue()
+	}
+
+	return summary
+}
+
+// protoToDistribution is the inverse of pointToDistributionValue.
+// Exemplar attachments are sent as strings and decoded as such.
+func protoToDistribution(pb *v1.DistributionValue) (*metricdata.Distribution, error) {
+	distribution := &metricdata.Distribution{
+		Count:                 pb.GetCount(),
+		Sum:                   pb.GetSum(),
+		SumOfSquaredDeviation: pb.GetSumOfSquaredDeviation(),
+		BucketOptions: &metricdata.BucketOptions{
+			Bounds: pb.GetBucketOptions().GetExplicit().GetBounds(),
+		},
+		Buckets: []metricdata.Bucket{},
+	}
+
+	for _, b := range pb.GetBuckets() {
+		bucket := metricdata.Bucket{Count: b.GetCount()}
+
+		if e := b.GetExemplar(); e != nil {
+			t, err := protoToTime(e.GetTimestamp())
+			if err != nil {
+				return nil, errors.Wrap(err, "Invalid exemplar timestamp")
+			}
+
+			bucket.Exemplar = &metricdata.Exemplar{
+				Value:       e.GetValue(),
+				Timestamp:   t,
+				Attachments: metricdata.Attachments{},
+			}
+
+			for k, v := range e.GetAttachments() {
+				bucket.Exemplar.Attachments[k] = v
+			}
+		}
+
+		distribution.Buckets = append(distribution.Buckets, bucket)
+	}
+
+	return distribution, nil
+}
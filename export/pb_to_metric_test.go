@@ -0,0 +1,143 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// decoded times are in UTC and without a monotonic reading
+	roundTripTime = time.Unix(1600000000, 123456789).UTC()
+
+	roundTripResource = &resource.Resource{Type: "host", Labels: map[string]string{"host.hostname": "localhost"}}
+
+	roundTripMetrics = []*metricdata.Metric{
+		&metricdata.Metric{
+			Descriptor: metricdata.Descriptor{
+				Name:        "gauge",
+				Description: dummyDesc,
+				Unit:        metricdata.UnitBytes,
+				Type:        metricdata.TypeGaugeInt64,
+				LabelKeys:   []metricdata.LabelKey{{Key: "present", Description: dummyKeyDesc}, {Key: "absent"}},
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				&metricdata.TimeSeries{
+					LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("val"), metricdata.LabelValue{}},
+					Points:      []metricdata.Point{metricdata.NewInt64Point(roundTripTime, intVal)},
+					StartTime:   roundTripTime,
+				},
+			},
+			Resource: roundTripResource,
+		},
+		&metricdata.Metric{
+			Descriptor: metricdata.Descriptor{
+				Name:      "latency",
+				Unit:      metricdata.UnitMilliseconds,
+				Type:      metricdata.TypeCumulativeDistribution,
+				LabelKeys: []metricdata.LabelKey{{Key: dummyLabelKey}},
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				&metricdata.TimeSeries{
+					LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue(dummyLabelVal)},
+					Points: []metricdata.Point{metricdata.NewDistributionPoint(roundTripTime, &metricdata.Distribution{
+						Count:                 3,
+						Sum:                   12,
+						SumOfSquaredDeviation: 2,
+						BucketOptions:         &metricdata.BucketOptions{Bounds: []float64{5}},
+						Buckets: []metricdata.Bucket{
+							{Count: 2},
+							{Count: 1, Exemplar: &metricdata.Exemplar{
+								Value:       6,
+								Timestamp:   roundTripTime,
+								Attachments: metricdata.Attachments{"trace_id": "abc"},
+							}},
+						},
+					})},
+					StartTime: roundTripTime,
+				},
+			},
+			Resource: &resource.Resource{Type: "container", Labels: map[string]string{"container.name": "broker"}},
+		},
+		&metricdata.Metric{
+			Descriptor: metricdata.Descriptor{
+				Name:      "summary",
+				Type:      metricdata.TypeSummary,
+				LabelKeys: []metricdata.LabelKey{{Key: dummyLabelKey}},
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				&metricdata.TimeSeries{
+					LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue(dummyLabelVal)},
+					Points: []metricdata.Point{metricdata.NewSummaryPoint(roundTripTime, &metricdata.Summary{
+						Count:          intVal,
+						Sum:            doubleVal,
+						HasCountAndSum: true,
+						Snapshot: metricdata.Snapshot{
+							Count:       intVal,
+							Sum:         doubleVal,
+							Percentiles: map[float64]float64{50: 1, 99: 2},
+						},
+					})},
+					StartTime: roundTripTime,
+				},
+			},
+			Resource: roundTripResource,
+		},
+	}
+)
+
+func TestDecodeServiceRequestRoundTrip(t *testing.T) {
+	for _, encoder := range []Encoder{ProtobufEncoder, JSONEncoder} {
+		request, err := metricsToServiceRequest(roundTripMetrics, roundTripResource)
+		if err != nil {
+			t.Fatalf("Error converting metrics to service proto: %v", err)
+		}
+
+		payload, err := encoder.Encode(request)
+		if err != nil {
+			t.Fatalf("Error encoding %v payload: %v", encoder.ContentType(), err)
+		}
+
+		got, err := DecodeServiceRequest(payload, encoder.ContentType())
+		if err != nil {
+			t.Fatalf("Error decoding %v payload: %v", encoder.ContentType(), err)
+		}
+
+		if !reflect.DeepEqual(roundTripMetrics, got) {
+			t.Errorf("Decode service request failed for %v, expected %v, got %v", encoder.ContentType(), roundTripMetrics, got)
+		}
+	}
+}
+
+func TestDecodeMetricRoundTrip(t *testing.T) {
+	for _, want := range roundTripMetrics {
+		pb, err := metricToProto(want)
+		if err != nil {
+			t.Fatalf("Error converting metric to proto: %v", err)
+		}
+
+		payload, err := proto.Marshal(pb)
+		if err != nil {
+			t.Fatalf("Marshalling error: %v", err)
+		}
+
+		got, err := DecodeMetric(payload, "")
+		if err != nil {
+			t.Fatalf("Error decoding metric payload: %v", err)
+		}
+
+		if len(got) != 1 || !reflect.DeepEqual(want, got[0]) {
+			t.Errorf("Decode metric failed, expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestDecodeUnsupportedContentType(t *testing.T) {
+	if _, err := DecodeMetric(nil, "text/plain"); err == nil {
+		t.Errorf("Expected error decoding payload with unsupported content type")
+	}
+}
@@ -0,0 +1,37 @@
+package export
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+)
+
+// Processor transforms the metrics read on each reporting
+// tick before they are handed to an exporter. Processors
+// must not modify the metrics they are given in place.
+type Processor interface {
+	Process(data []*metricdata.Metric) ([]*metricdata.Metric, error)
+}
+
+// processingExporter runs the configured processors, in order,
+// on the metrics before exporting them with the wrapped exporter.
+type processingExporter struct {
+	metricexport.Exporter
+	processors []Processor
+}
+
+// ExportMetrics processes the metrics and exports the result.
+func (p *processingExporter) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	for _, processor := range p.processors {
+		processed, err := processor.Process(data)
+		if err != nil {
+			return errors.Wrap(err, "Error processing metrics")
+		}
+
+		data = processed
+	}
+
+	return p.Exporter.ExportMetrics(ctx, data)
+}
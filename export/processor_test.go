@@ -0,0 +1,43 @@
+package export
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+type renameProcessor struct {
+	name string
+}
+
+func (r renameProcessor) Process(data []*metricdata.Metric) ([]*metricdata.Metric, error) {
+	res := []*metricdata.Metric{}
+	for _, d := range data {
+		renamed := *d
+		renamed.Descriptor.Name = r.name
+		res = append(res, &renamed)
+	}
+
+	return res, nil
+}
+
+func TestProcessingExporterRunsProcessorsInOrder(t *testing.T) {
+	recorder := &recordingExporter{}
+	exporter := &processingExporter{
+		Exporter:   recorder,
+		processors: []Processor{renameProcessor{name: "first"}, renameProcessor{name: "second"}},
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error exporting processed metrics: %v", err)
+	}
+
+	if len(recorder.exported) != 1 || recorder.exported[0][0].Descriptor.Name != "second" {
+		t.Errorf("Processing exporter failed, expected metric named second, got %v", recorder.exported)
+	}
+
+	if metric.Descriptor.Name != dummyName {
+		t.Errorf("Processing exporter modified its input metric")
+	}
+}
@@ -0,0 +1,297 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	invalidPrometheusNameChars  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	invalidPrometheusLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	prometheusHelpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// Prometheus is an http.Handler that serves the metrics in
+// the Prometheus text exposition format when scraped.
+type Prometheus struct {
+	config Config
+	read   func() []*metricdata.Metric
+}
+
+// NewPrometheusHandler returns a new Prometheus handler. Unlike the other
+// exporters it isn't started, the metrics are read on every scrape.
+func NewPrometheusHandler(config Config) http.Handler {
+	return Prometheus{
+		config: config,
+		read:   readProducers,
+	}
+}
+
+func readProducers() []*metricdata.Metric {
+	data := []*metricdata.Metric{}
+	for _, producer := range metricproducer.GlobalManager().GetAll() {
+		data = append(data, producer.Read()...)
+	}
+
+	return data
+}
+
+// ServeHTTP reads the metrics, processes and filters them,
+// and writes them in the Prometheus text exposition format.
+func (e Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource, err := TotDetector(r.Context())
+	if err != nil {
+		http.Error(w, errors.Wrap(err, "Error creating resource detector").Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := e.read()
+	for _, processor := range e.config.Processors {
+		if data, err = processor.Process(data); err != nil {
+			http.Error(w, errors.Wrap(err, "Error processing metrics").Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		http.Error(w, errors.Wrap(err, "Error creating metric filter").Error(), http.StatusInternalServerError)
+		return
+	}
+
+	includeData := []*metricdata.Metric{}
+	for _, d := range data {
+		if filter.matches(d.Descriptor.Name) {
+			includeData = append(includeData, d)
+		}
+	}
+
+	// the exposition is rendered before writing any of it, so that
+	// an error can still be reported with its status
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, includeData, resource.Labels); err != nil {
+		http.Error(w, errors.Wrap(err, "Error writing metrics").Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	buf.WriteTo(w)
+}
+
+func sanitizePrometheusName(name string) string {
+	name = invalidPrometheusNameChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func sanitizePrometheusLabel(key string) string {
+	key = invalidPrometheusLabelChars.ReplaceAllString(key, "_")
+	if key != "" && key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+
+	return key
+}
+
+func prometheusType(metricType metricdata.Type) string {
+	switch metricType {
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+		return "counter"
+	case metricdata.TypeCumulativeDistribution, metricdata.TypeGaugeDistribution:
+		return "histogram"
+	case metricdata.TypeSummary:
+		return "summary"
+	default:
+		return "gauge"
+	}
+}
+
+func formatPrometheusFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// prometheusLabel is a sanitized label name and its value.
+type prometheusLabel struct {
+	name  string
+	value string
+}
+
+func formatPrometheusLabels(labels []prometheusLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, l.name, prometheusLabelValueEscaper.Replace(l.value)))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func resourceToPrometheusLabels(resourceLabels map[string]string) []prometheusLabel {
+	keys := make([]string, 0, len(resourceLabels))
+	for k := range resourceLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := []prometheusLabel{}
+	for _, k := range keys {
+		labels = append(labels, prometheusLabel{name: sanitizePrometheusLabel(k), value: resourceLabels[k]})
+	}
+
+	return labels
+}
+
+// timeSeriesToPrometheusLabels returns the resource labels followed by
+// the time series' labels. Prometheus rejects series repeating a label
+// name, so a metric label wins over a resource label sanitized to the
+// same name, and only the first of such metric labels is kept.
+func timeSeriesToPrometheusLabels(m *metricdata.Metric, ts *metricdata.TimeSeries, resourceLabels []prometheusLabel) []prometheusLabel {
+	names := map[string]bool{}
+	metricLabels := []prometheusLabel{}
+
+	for i, lv := range ts.LabelValues {
+		if !lv.Present || i >= len(m.Descriptor.LabelKeys) {
+			continue
+		}
+
+		name := sanitizePrometheusLabel(m.Descriptor.LabelKeys[i].Key)
+		if names[name] {
+			continue
+		}
+		names[name] = true
+
+		metricLabels = append(metricLabels, prometheusLabel{name: name, value: lv.Value})
+	}
+
+	labels := []prometheusLabel{}
+	for _, l := range resourceLabels {
+		if !names[l.name] {
+			labels = append(labels, l)
+		}
+	}
+
+	return append(labels, metricLabels...)
+}
+
+func writePrometheus(w io.Writer, data []*metricdata.Metric, resourceLabels map[string]string) error {
+	b := bufio.NewWriter(w)
+	resource := resourceToPrometheusLabels(resourceLabels)
+	written := map[string]string{}
+
+	for _, m := range data {
+		name := sanitizePrometheusName(m.Descriptor.Name)
+		if previous, ok := written[name]; ok {
+			log.Printf("Skipping metric %v, its Prometheus name %v is already used by metric %v", m.Descriptor.Name, name, previous)
+			continue
+		}
+		written[name] = m.Descriptor.Name
+
+		fmt.Fprintf(b, "# HELP %v %v\n", name, prometheusHelpEscaper.Replace(m.Descriptor.Description))
+		fmt.Fprintf(b, "# TYPE %v %v\n", name, prometheusType(m.Descriptor.Type))
+
+		for _, ts := range m.TimeSeries {
+			labels := timeSeriesToPrometheusLabels(m, ts, resource)
+
+			for _, p := range ts.Points {
+				samples, err := pointToPrometheusSamples(name, labels, p)
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error writing metric %v", m.Descriptor.Name))
+				}
+
+				for _, sample := range samples {
+					fmt.Fprintf(b, "%v%v %v\n", sample.name, formatPrometheusLabels(sample.labels), formatPrometheusFloat(sample.value))
+				}
+			}
+		}
+	}
+
+	return b.Flush()
+}
+
+// prometheusSample is a single sample of the exposition
+// format, a metric point expands into one or more samples.
+type prometheusSample struct {
+	name   string
+	labels []prometheusLabel
+	value  float64
+}
+
+func withLabel(labels []prometheusLabel, name string, value string) []prometheusLabel {
+	return append(append([]prometheusLabel{}, labels...), prometheusLabel{name: name, value: value})
+}
+
+func pointToPrometheusSamples(name string, labels []prometheusLabel, p metricdata.Point) ([]prometheusSample, error) {
+	switch v := p.Value.(type) {
+	case int64:
+		return []prometheusSample{{name: name, labels: labels, value: float64(v)}}, nil
+	case float64:
+		return []prometheusSample{{name: name, labels: labels, value: v}}, nil
+	case *metricdata.Distribution:
+		var bounds []float64
+		if v.BucketOptions != nil {
+			bounds = v.BucketOptions.Bounds
+		}
+
+		samples := []prometheusSample{}
+		cumulative := int64(0)
+		for i, bucket := range v.Buckets {
+			if i >= len(bounds) {
+				break
+			}
+
+			cumulative += bucket.Count
+			samples = append(samples, prometheusSample{
+				name:   name + "_bucket",
+				labels: withLabel(labels, "le", formatPrometheusFloat(bounds[i])),
+				value:  float64(cumulative),
+			})
+		}
+
+		return append(samples,
+			prometheusSample{name: name + "_bucket", labels: withLabel(labels, "le", "+Inf"), value: float64(v.Count)},
+			prometheusSample{name: name + "_sum", labels: labels, value: v.Sum},
+			prometheusSample{name: name + "_count", labels: labels, value: float64(v.Count)},
+		), nil
+	case *metricdata.Summary:
+		samples := []prometheusSample{}
+		for _, percentile := range sortedPercentiles(v) {
+			samples = append(samples, prometheusSample{
+				name:   name,
+				labels: withLabel(labels, "quantile", formatPrometheusFloat(percentile/100)),
+				value:  v.Snapshot.Percentiles[percentile],
+			})
+		}
+
+		if v.HasCountAndSum {
+			samples = append(samples,
+				prometheusSample{name: name + "_sum", labels: labels, value: v.Sum},
+				prometheusSample{name: name + "_count", labels: labels, value: float64(v.Count)},
+			)
+		}
+
+		return samples, nil
+	default:
+		return nil, errors.New("Unsupported value type")
+	}
+}
@@ -0,0 +1,153 @@
+package export
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func renamed(m *metricdata.Metric, name string) *metricdata.Metric {
+	res := *m
+	res.Descriptor.Name = name
+	return &res
+}
+
+func TestSanitizePrometheusName(t *testing.T) {
+	want := map[string]string{
+		"kafka.bytes-in": "kafka_bytes_in",
+		"1st_metric":     "_1st_metric",
+		"ns:metric":      "ns:metric",
+	}
+
+	for name, sanitized := range want {
+		if got := sanitizePrometheusName(name); got != sanitized {
+			t.Errorf("Sanitize Prometheus name failed, expected %v, got %v", sanitized, got)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	data := []*metricdata.Metric{
+		metric,
+		renamed(distributionMetric, "latency.ms"),
+		renamed(summaryMetric, "summary"),
+		renamed(metric, "metric"),
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	err := writePrometheus(&buf, data, map[string]string{"host.hostname": "localhost"})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatalf("Error writing Prometheus metrics: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "Skipping metric metric, its Prometheus name metric is already used by metric "+dummyName) {
+		t.Errorf("Write Prometheus failed, expected the name collision to be logged, got %v", logs.String())
+	}
+
+	want := []string{
+		"# HELP metric desc\n# TYPE metric counter\n",
+		`metric{host_hostname="localhost",Key="Val"} 10`,
+		"# TYPE latency_ms histogram\n",
+		`latency_ms_bucket{le="10"} 10`,
+		`latency_ms_bucket{le="20"} 20`,
+		`latency_ms_bucket{le="+Inf"} 30`,
+		`latency_ms_sum 450`,
+		`latency_ms_count 30`,
+		"# TYPE summary summary\n",
+		`summary{quantile="0.5"} 1`,
+		`summary{quantile="0.99"} 2`,
+		`summary_count 10`,
+	}
+
+	got := strings.Replace(buf.String(), `host_hostname="localhost",`, "", -1)
+	got = strings.Replace(got, `{host_hostname="localhost"}`, "", -1)
+	for _, w := range want[2:] {
+		if !strings.Contains(got, w) {
+			t.Errorf("Write Prometheus failed, could not find %v in %v", w, buf.String())
+		}
+	}
+
+	for _, w := range want[:2] {
+		if strings.Count(buf.String(), w) != 1 {
+			t.Errorf("Write Prometheus failed, expected %v exactly once in %v", w, buf.String())
+		}
+	}
+}
+
+func TestWritePrometheusLabelCollision(t *testing.T) {
+	collided := *metric
+	collided.Descriptor.LabelKeys = []metricdata.LabelKey{{Key: "host.hostname"}}
+
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, []*metricdata.Metric{&collided}, map[string]string{"host.hostname": "localhost"}); err != nil {
+		t.Fatalf("Error writing Prometheus metrics: %v", err)
+	}
+
+	// the metric label wins over the resource label
+	if want := `metric{host_hostname="Val"} 10`; !strings.Contains(buf.String(), want) {
+		t.Errorf("Write Prometheus failed, expected %v in %v", want, buf.String())
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	handler := Prometheus{
+		config: Config{IncludeFilter: `^metric$`},
+		read: func() []*metricdata.Metric {
+			return []*metricdata.Metric{metric, renamed(summaryMetric, "summary")}
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Prometheus handler failed, expected status %v, got %v", http.StatusOK, recorder.Code)
+	}
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != prometheusContentType {
+		t.Errorf("Prometheus handler failed, expected content type %v, got %v", prometheusContentType, contentType)
+	}
+
+	body := recorder.Body.String()
+	if !strings.Contains(body, "# TYPE metric counter\n") || !strings.Contains(body, `Key="Val"} 10`) {
+		t.Errorf("Prometheus handler failed, could not find metric in %v", body)
+	}
+
+	if strings.Contains(body, "summary") {
+		t.Errorf("Prometheus handler failed, expected summary to be filtered out of %v", body)
+	}
+}
+
+func TestPrometheusHandlerError(t *testing.T) {
+	unsupported := renamed(metric, "unsupported")
+	unsupported.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{Points: []metricdata.Point{{Time: timeNow, Value: "invalid"}}},
+	}
+
+	handler := Prometheus{
+		read: func() []*metricdata.Metric {
+			return []*metricdata.Metric{metric, unsupported}
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Prometheus handler failed, expected status %v, got %v", http.StatusInternalServerError, recorder.Code)
+	}
+
+	// none of the exposition is written before the error
+	if body := recorder.Body.String(); strings.Contains(body, "# TYPE") {
+		t.Errorf("Prometheus handler failed, expected only the error in %v", body)
+	}
+}
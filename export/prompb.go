@@ -0,0 +1,177 @@
+package export
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of the Prometheus remote write protocol sent by the
+// RemoteWrite exporter, from prometheus/prompb remote.proto and
+// types.proto. They're encoded by hand so that the exporter doesn't
+// depend on the whole Prometheus module.
+
+// prompbWriteRequest is the remote write prometheus.WriteRequest.
+type prompbWriteRequest struct {
+	Timeseries []prompbTimeSeries
+}
+
+// prompbTimeSeries is the remote write prometheus.TimeSeries.
+type prompbTimeSeries struct {
+	Labels  []prompbLabel
+	Samples []prompbSample
+}
+
+// prompbLabel is the remote write prometheus.Label.
+type prompbLabel struct {
+	Name  string
+	Value string
+}
+
+// prompbSample is the remote write prometheus.Sample, with its
+// timestamp in milliseconds since the epoch.
+type prompbSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Marshal encodes the request in the protobuf binary format.
+func (w *prompbWriteRequest) Marshal() ([]byte, error) {
+	b := []byte{}
+	for _, ts := range w.Timeseries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts.marshal())
+	}
+
+	return b, nil
+}
+
+func (ts prompbTimeSeries) marshal() []byte {
+	b := []byte{}
+	for _, l := range ts.Labels {
+		label := []byte{}
+		if l.Name != "" {
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+		}
+		if l.Value != "" {
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+		}
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+
+	for _, s := range ts.Samples {
+		sample := []byte{}
+		if s.Value != 0 {
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		}
+		if s.Timestamp != 0 {
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+		}
+
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sample)
+	}
+
+	return b
+}
+
+// Unmarshal decodes the request from the protobuf binary
+// format, skipping the fields the exporter doesn't send.
+func (w *prompbWriteRequest) Unmarshal(b []byte) error {
+	*w = prompbWriteRequest{}
+	return unmarshalPrompbFields(b, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		ts := prompbTimeSeries{}
+		if err := ts.unmarshal(value); err != nil {
+			return err
+		}
+
+		w.Timeseries = append(w.Timeseries, ts)
+		return nil
+	})
+}
+
+func (ts *prompbTimeSeries) unmarshal(b []byte) error {
+	return unmarshalPrompbFields(b, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			l := prompbLabel{}
+			err := unmarshalPrompbFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					l.Name = string(value)
+				case 2:
+					l.Value = string(value)
+				}
+				return nil
+			})
+
+			ts.Labels = append(ts.Labels, l)
+			return err
+		case 2:
+			s := prompbSample{}
+			err := unmarshalPrompbFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					v, n := protowire.ConsumeFixed64(value)
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					s.Value = math.Float64frombits(v)
+				case 2:
+					v, n := protowire.ConsumeVarint(value)
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					s.Timestamp = int64(v)
+				}
+				return nil
+			})
+
+			ts.Samples = append(ts.Samples, s)
+			return err
+		default:
+			return nil
+		}
+	})
+}
+
+// unmarshalPrompbFields calls field with the number and the raw value
+// of every field of the message. Length-delimited values are passed
+// without their length, and others as encoded.
+func unmarshalPrompbFields(b []byte, field func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errors.Wrap(protowire.ParseError(n), "Error unmarshalling remote write message")
+		}
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return errors.Wrap(protowire.ParseError(n), "Error unmarshalling remote write message")
+		}
+
+		value := b[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+
+		if err := field(num, value); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrompbWriteRequestMarshal(t *testing.T) {
+	writeRequest := &prompbWriteRequest{Timeseries: []prompbTimeSeries{{
+		Labels:  []prompbLabel{{Name: "__name__", Value: "a"}},
+		Samples: []prompbSample{{Value: 1.5, Timestamp: 1000}},
+	}}}
+
+	got, err := writeRequest.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling write request: %v", err)
+	}
+
+	// as encoded by the prometheus/prompb package
+	want := []byte{
+		10, 29,
+		10, 13, 10, 8, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 18, 1, 'a',
+		18, 12, 9, 0, 0, 0, 0, 0, 0, 248, 63, 16, 232, 7,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Write request marshal failed, expected %v, got %v", want, got)
+	}
+
+	decoded := &prompbWriteRequest{}
+	if err := decoded.Unmarshal(got); err != nil {
+		t.Fatalf("Error unmarshalling write request: %v", err)
+	}
+
+	if !reflect.DeepEqual(writeRequest, decoded) {
+		t.Errorf("Write request unmarshal failed, expected %v, got %v", writeRequest, decoded)
+	}
+}
+
+func TestPrompbWriteRequestUnmarshalInvalid(t *testing.T) {
+	if err := (&prompbWriteRequest{}).Unmarshal([]byte{10, 30, 10}); err == nil {
+		t.Errorf("Expected error unmarshalling a truncated write request")
+	}
+}
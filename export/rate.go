@@ -0,0 +1,120 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+const rateSuffix = "_rate"
+
+type rateDerivation struct {
+	filter *regexp.Regexp
+	deltas *deltaTracker
+}
+
+// NewRateDerivation returns a Processor that emits a per second
+// rate gauge named <name>_rate alongside every cumulative counter
+// whose name matches filter. Rates are computed from consecutive
+// points, so the first observation of each series is skipped. A
+// counter that goes down or restarts is treated as reset to zero.
+func NewRateDerivation(filter string) (Processor, error) {
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error compiling rate derivation filter %v", filter))
+	}
+
+	return &rateDerivation{
+		filter: re,
+		deltas: newDeltaTracker(),
+	}, nil
+}
+
+// Process appends the rates of the matching counters to the metrics.
+func (r *rateDerivation) Process(data []*metricdata.Metric) ([]*metricdata.Metric, error) {
+	defer r.deltas.prune()
+
+	res := make([]*metricdata.Metric, 0, len(data))
+	for _, d := range data {
+		res = append(res, d)
+
+		if !isCumulativeCounter(d.Descriptor.Type) || !r.filter.MatchString(d.Descriptor.Name) {
+			continue
+		}
+
+		rate, err := r.derive(d)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error deriving rate of metric %v", d.Descriptor.Name))
+		}
+
+		if rate != nil {
+			res = append(res, rate)
+		}
+	}
+
+	return res, nil
+}
+
+func isCumulativeCounter(metricType metricdata.Type) bool {
+	return metricType == metricdata.TypeCumulativeInt64 || metricType == metricdata.TypeCumulativeFloat64
+}
+
+func (r *rateDerivation) derive(m *metricdata.Metric) (*metricdata.Metric, error) {
+	timeSeries := []*metricdata.TimeSeries{}
+
+	for _, ts := range m.TimeSeries {
+		key := fmt.Sprintf("%q%v", m.Descriptor.Name, labelValuesKey(ts.LabelValues))
+		points := []metricdata.Point{}
+
+		for _, p := range ts.Points {
+			value, err := pointToFloat64(p)
+			if err != nil {
+				return nil, err
+			}
+
+			// points that don't move forward in time have no rate
+			increase, elapsed, ok := r.deltas.value(key, ts.StartTime, p.Time, value)
+			if !ok || elapsed <= 0 {
+				continue
+			}
+
+			points = append(points, metricdata.NewFloat64Point(p.Time, increase/elapsed.Seconds()))
+		}
+
+		if len(points) != 0 {
+			timeSeries = append(timeSeries, &metricdata.TimeSeries{
+				LabelValues: ts.LabelValues,
+				Points:      points,
+				StartTime:   ts.StartTime,
+			})
+		}
+	}
+
+	if len(timeSeries) == 0 {
+		return nil, nil
+	}
+
+	descriptor := m.Descriptor
+	descriptor.Name += rateSuffix
+	descriptor.Unit = metricdata.Unit(string(m.Descriptor.Unit) + "/s")
+	descriptor.Type = metricdata.TypeGaugeFloat64
+
+	return &metricdata.Metric{
+		Descriptor: descriptor,
+		Resource:   m.Resource,
+		TimeSeries: timeSeries,
+	}, nil
+}
+
+func pointToFloat64(p metricdata.Point) (float64, error) {
+	switch v := p.Value.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, errors.New("Unsupported value type")
+	}
+}
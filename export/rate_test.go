@@ -0,0 +1,75 @@
+package export
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func counterAt(t time.Time, start time.Time, value int64) *metricdata.Metric {
+	return &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name: dummyName,
+			Unit: metricdata.UnitBytes,
+			Type: metricdata.TypeCumulativeInt64,
+		},
+		TimeSeries: []*metricdata.TimeSeries{
+			&metricdata.TimeSeries{
+				Points:    []metricdata.Point{metricdata.NewInt64Point(t, value)},
+				StartTime: start,
+			},
+		},
+	}
+}
+
+func processRate(t *testing.T, processor Processor, m *metricdata.Metric) []*metricdata.Metric {
+	res, err := processor.Process([]*metricdata.Metric{m})
+	if err != nil {
+		t.Fatalf("Error deriving rates: %v", err)
+	}
+
+	return res
+}
+
+func checkRate(t *testing.T, res []*metricdata.Metric, want float64) {
+	if len(res) != 2 {
+		t.Fatalf("Rate derivation failed, expected 2 metrics, got %v", len(res))
+	}
+
+	rate := res[1]
+	if rate.Descriptor.Name != dummyName+rateSuffix || rate.Descriptor.Type != metricdata.TypeGaugeFloat64 {
+		t.Errorf("Rate derivation failed, got descriptor %v", rate.Descriptor)
+	}
+
+	if got := rate.TimeSeries[0].Points[0].Value.(float64); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Rate derivation failed, expected rate %v, got %v", want, got)
+	}
+}
+
+func TestRateDerivation(t *testing.T) {
+	processor, err := NewRateDerivation(dummyName)
+	if err != nil {
+		t.Fatalf("Error creating rate derivation: %v", err)
+	}
+
+	if res := processRate(t, processor, counterAt(timeNow, timeNow, 10)); len(res) != 1 {
+		t.Errorf("Rate derivation failed, expected first observation to be skipped, got %v metrics", len(res))
+	}
+
+	checkRate(t, processRate(t, processor, counterAt(timeNow.Add(10*time.Second), timeNow, 60)), 5)
+}
+
+func TestRateDerivationReset(t *testing.T) {
+	processor, err := NewRateDerivation(dummyName)
+	if err != nil {
+		t.Fatalf("Error creating rate derivation: %v", err)
+	}
+
+	processRate(t, processor, counterAt(timeNow, timeNow, 100))
+	checkRate(t, processRate(t, processor, counterAt(timeNow.Add(10*time.Second), timeNow, 20)), 2)
+
+	restart := timeNow.Add(15 * time.Second)
+	checkRate(t, processRate(t, processor, counterAt(timeNow.Add(20*time.Second), restart, 30)), 3)
+}
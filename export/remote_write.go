@@ -0,0 +1,167 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+const remoteWriteVersion = "0.1.0"
+
+// RemoteWriteConfig holds the configurations of a Prometheus
+// remote write endpoint. Username and Password are sent with
+// basic auth, BearerToken (if set) as an Authorization header.
+type RemoteWriteConfig struct {
+	Address     string
+	Username    string
+	Password    string
+	BearerToken string
+	Headers     map[string]string
+}
+
+// RemoteWrite is an exporter that pushes metrics to a Prometheus
+// remote write endpoint, such as Cortex, Mimir or Thanos receivers.
+type RemoteWrite struct {
+	remoteWriteConfig RemoteWriteConfig
+	client            *http.Client
+	config            Config
+}
+
+// NewRemoteWrite returns a new exporter agent with a RemoteWrite exporter attached
+func NewRemoteWrite(remoteWriteConfig RemoteWriteConfig, config Config) (*ExporterAgent, error) {
+	exporter := RemoteWrite{
+		remoteWriteConfig: remoteWriteConfig,
+		client:            newDefaultHTTPClient(),
+		config:            config,
+	}
+
+	agent := newExporterAgent(exporter, exporter.config)
+	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
+		return nil, errors.Wrap(err, "Couldn't Start Exporter")
+	}
+
+	return agent, nil
+}
+
+// ExportMetrics converts the metrics to a remote write request and
+// POSTs it snappy-compressed to the remote write endpoint.
+func (e RemoteWrite) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	resource, err := TotDetector(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Error creating resource detector")
+	}
+
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	includeData := []*metricdata.Metric{}
+	for _, d := range data {
+		if filter.matches(d.Descriptor.Name) {
+			includeData = append(includeData, d)
+		}
+	}
+
+	writeRequest, err := metricsToWriteRequest(includeData, resource.Labels)
+	if err != nil {
+		return errors.Wrap(err, "Error converting metrics to write request")
+	}
+
+	payload, err := writeRequest.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "Marshalling error")
+	}
+
+	if err := e.postMetrics(ctx, snappy.Encode(nil, payload)); err != nil {
+		return errors.Wrap(err, "Error sending metrics")
+	}
+
+	return nil
+}
+
+func (e RemoteWrite) postMetrics(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", e.remoteWriteConfig.Address, bytes.NewBuffer(payload))
+	if err != nil {
+		return errors.Wrap(err, "Error creating POST request")
+	}
+
+	for headerKey, headerVal := range e.remoteWriteConfig.Headers {
+		req.Header.Set(headerKey, headerVal)
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	if e.remoteWriteConfig.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.remoteWriteConfig.BearerToken)
+	} else if e.remoteWriteConfig.Username != "" {
+		req.SetBasicAuth(e.remoteWriteConfig.Username, e.remoteWriteConfig.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Error sending request")
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("Remote write endpoint responded with status %v", resp.Status)
+	}
+
+	return nil
+}
+
+func metricsToWriteRequest(ms []*metricdata.Metric, resourceLabels map[string]string) (*prompbWriteRequest, error) {
+	resource := resourceToPrometheusLabels(resourceLabels)
+	timeSeries := []prompbTimeSeries{}
+
+	for _, m := range ms {
+		name := sanitizePrometheusName(m.Descriptor.Name)
+
+		for _, ts := range m.TimeSeries {
+			labels := timeSeriesToPrometheusLabels(m, ts, resource)
+
+			for _, p := range ts.Points {
+				samples, err := pointToPrometheusSamples(name, labels, p)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("Error converting metric %v", m.Descriptor.Name))
+				}
+
+				for _, sample := range samples {
+					timeSeries = append(timeSeries, prompbTimeSeries{
+						Labels: sampleToPrompbLabels(sample),
+						Samples: []prompbSample{{
+							Value:     sample.value,
+							Timestamp: p.Time.UnixNano() / 1e6,
+						}},
+					})
+				}
+			}
+		}
+	}
+
+	return &prompbWriteRequest{Timeseries: timeSeries}, nil
+}
+
+// sampleToPrompbLabels returns the sample's labels and its name,
+// sorted by label name as required by remote write receivers.
+func sampleToPrompbLabels(sample prometheusSample) []prompbLabel {
+	labels := []prompbLabel{{Name: "__name__", Value: sample.name}}
+	for _, l := range sample.labels {
+		labels = append(labels, prompbLabel{Name: l.name, Value: l.value})
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+
+	return labels
+}
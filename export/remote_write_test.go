@@ -0,0 +1,158 @@
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+	"go.opencensus.io/metric/metricdata"
+)
+
+func remoteWriteReceiver(t *testing.T, received chan<- *prompbWriteRequest, headers chan<- http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+
+		compressed, _ := ioutil.ReadAll(r.Body)
+		payload, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("Error decompressing remote write payload: %v", err)
+		}
+
+		writeRequest := &prompbWriteRequest{}
+		if err := writeRequest.Unmarshal(payload); err != nil {
+			t.Errorf("Error unmarshalling remote write payload: %v", err)
+		}
+
+		received <- writeRequest
+	}))
+}
+
+func TestMetricsToWriteRequest(t *testing.T) {
+	got, err := metricsToWriteRequest([]*metricdata.Metric{metric}, map[string]string{"host.hostname": "localhost"})
+	if err != nil {
+		t.Fatalf("Error converting metrics to write request: %v", err)
+	}
+
+	if len(got.Timeseries) != 1 {
+		t.Fatalf("Metrics to write request failed, expected 1 series, got %v", len(got.Timeseries))
+	}
+
+	wantLabels := []prompbLabel{
+		{Name: dummyLabelKey, Value: dummyLabelVal},
+		{Name: "__name__", Value: dummyName},
+		{Name: "host_hostname", Value: "localhost"},
+	}
+
+	series := got.Timeseries[0]
+	if len(series.Labels) != len(wantLabels) {
+		t.Fatalf("Metrics to write request failed, expected labels %v, got %v", wantLabels, series.Labels)
+	}
+
+	for i := range wantLabels {
+		if series.Labels[i].Name != wantLabels[i].Name || series.Labels[i].Value != wantLabels[i].Value {
+			t.Errorf("Metrics to write request failed, expected labels %v, got %v", wantLabels, series.Labels)
+		}
+	}
+
+	if series.Samples[0].Value != float64(intVal) || series.Samples[0].Timestamp != timeNow.UnixNano()/1e6 {
+		t.Errorf("Metrics to write request failed, got sample %v", series.Samples[0])
+	}
+}
+
+func TestMetricsToWriteRequestLabelCollision(t *testing.T) {
+	collided := *metric
+	collided.Descriptor.LabelKeys = []metricdata.LabelKey{{Key: "host.hostname"}}
+
+	got, err := metricsToWriteRequest([]*metricdata.Metric{&collided}, map[string]string{"host.hostname": "localhost"})
+	if err != nil {
+		t.Fatalf("Error converting metrics to write request: %v", err)
+	}
+
+	// receivers reject series with duplicate label names
+	wantLabels := []prompbLabel{
+		{Name: "__name__", Value: dummyName},
+		{Name: "host_hostname", Value: dummyLabelVal},
+	}
+
+	if labels := got.Timeseries[0].Labels; !reflect.DeepEqual(wantLabels, labels) {
+		t.Errorf("Metrics to write request failed, expected labels %v, got %v", wantLabels, labels)
+	}
+}
+
+func TestRemoteWriteExportMetrics(t *testing.T) {
+	received := make(chan *prompbWriteRequest, 1)
+	headers := make(chan http.Header, 1)
+	server := remoteWriteReceiver(t, received, headers)
+	defer server.Close()
+
+	exporter := RemoteWrite{
+		remoteWriteConfig: RemoteWriteConfig{
+			Address:     server.URL,
+			BearerToken: "token",
+		},
+		client: server.Client(),
+		config: config,
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error exporting metrics to remote write: %v", err)
+	}
+
+	header := <-headers
+	want := map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": remoteWriteVersion,
+		"Authorization":                     "Bearer token",
+	}
+
+	for k, v := range want {
+		if header.Get(k) != v {
+			t.Errorf("Remote write failed, expected header %v %v, got %v", k, v, header.Get(k))
+		}
+	}
+
+	if writeRequest := <-received; len(writeRequest.Timeseries) != 1 {
+		t.Errorf("Remote write failed, expected 1 series, got %v", len(writeRequest.Timeseries))
+	}
+}
+
+func TestRemoteWriteBasicAuthAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != apiKey || password != apiSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	exporter := RemoteWrite{
+		remoteWriteConfig: RemoteWriteConfig{Address: server.URL, Username: apiKey, Password: apiSecret},
+		client:            server.Client(),
+		config:            config,
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Errorf("Error exporting metrics to remote write: %v", err)
+	}
+
+	exporter.remoteWriteConfig.Password = "wrong"
+	if err := exporter.ExportMetrics(context.Background(), metrics); err == nil {
+		t.Errorf("Expected error exporting metrics with wrong credentials")
+	}
+}
+
+func TestNewRemoteWriteClient(t *testing.T) {
+	agent, err := NewRemoteWrite(RemoteWriteConfig{Address: "http://localhost"}, config)
+	if err != nil {
+		t.Fatalf("Error creating RemoteWrite exporter: %v", err)
+	}
+	agent.Stop()
+
+	if timeout := agent.Exporter.(RemoteWrite).client.Timeout; timeout != defaultHTTPTimeout {
+		t.Errorf("New RemoteWrite failed, expected client timeout %v, got %v", defaultHTTPTimeout, timeout)
+	}
+}
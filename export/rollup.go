@@ -0,0 +1,363 @@
+package export
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+// GaugeRollup selects how the points of merged gauge
+// series are combined.
+type GaugeRollup int
+
+const (
+	// GaugeLast keeps the most recent point of the merged series.
+	GaugeLast GaugeRollup = iota
+	// GaugeMax keeps the largest point of the merged series.
+	GaugeMax
+)
+
+// RollupRule removes labels from the metrics whose names match
+// Filter and merges the series left with identical label values.
+// If KeepLabels is set only those labels are kept, otherwise the
+// labels in DropLabels are removed. Cumulative series are summed,
+// distributions are merged bucket-wise and gauges are combined
+// according to Gauge. Summaries can't be merged and are left as is.
+type RollupRule struct {
+	Filter     string
+	KeepLabels []string
+	DropLabels []string
+	Gauge      GaugeRollup
+}
+
+type rollupRule struct {
+	filter *regexp.Regexp
+	keep   map[string]bool
+	drop   map[string]bool
+	gauge  GaugeRollup
+}
+
+type rollup struct {
+	rules []rollupRule
+}
+
+// NewRollup returns a Processor that applies the first matching
+// rule to each metric. Metrics that match no rule are left as is.
+func NewRollup(rules ...RollupRule) (Processor, error) {
+	compiled := []rollupRule{}
+
+	for _, r := range rules {
+		filter, err := regexp.Compile(r.Filter)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error compiling rollup filter %v", r.Filter))
+		}
+
+		compiled = append(compiled, rollupRule{
+			filter: filter,
+			keep:   stringSet(r.KeepLabels),
+			drop:   stringSet(r.DropLabels),
+			gauge:  r.Gauge,
+		})
+	}
+
+	return &rollup{rules: compiled}, nil
+}
+
+func stringSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+// Process rolls up the metrics matching one of the rules. A metric
+// whose series can't be merged is logged and passed through as is,
+// so that it doesn't fail the export of the other metrics.
+func (r *rollup) Process(data []*metricdata.Metric) ([]*metricdata.Metric, error) {
+	res := make([]*metricdata.Metric, 0, len(data))
+
+	for _, d := range data {
+		rule := r.match(d.Descriptor.Name)
+		if rule == nil || d.Descriptor.Type == metricdata.TypeSummary {
+			res = append(res, d)
+			continue
+		}
+
+		rolled, err := rule.apply(d)
+		if err != nil {
+			log.Printf("Error rolling up metric %v, exporting it as is: %v", d.Descriptor.Name, err)
+			res = append(res, d)
+			continue
+		}
+
+		res = append(res, rolled)
+	}
+
+	return res, nil
+}
+
+func (r *rollup) match(name string) *rollupRule {
+	for i := range r.rules {
+		if r.rules[i].filter.MatchString(name) {
+			return &r.rules[i]
+		}
+	}
+
+	return nil
+}
+
+func (r *rollupRule) kept(key string) bool {
+	if len(r.keep) != 0 {
+		return r.keep[key]
+	}
+
+	return !r.drop[key]
+}
+
+func (r *rollupRule) apply(m *metricdata.Metric) (*metricdata.Metric, error) {
+	indexes := []int{}
+	labelKeys := []metricdata.LabelKey{}
+
+	for i, lk := range m.Descriptor.LabelKeys {
+		if r.kept(lk.Key) {
+			indexes = append(indexes, i)
+			labelKeys = append(labelKeys, lk)
+		}
+	}
+
+	descriptor := m.Descriptor
+	descriptor.LabelKeys = labelKeys
+
+	series := []*metricdata.TimeSeries{}
+	merged := map[string]*metricdata.TimeSeries{}
+
+	for _, ts := range m.TimeSeries {
+		labelValues := []metricdata.LabelValue{}
+		for _, i := range indexes {
+			if i < len(ts.LabelValues) {
+				labelValues = append(labelValues, ts.LabelValues[i])
+			}
+		}
+
+		key := labelValuesKey(labelValues)
+		existing, ok := merged[key]
+		if !ok {
+			existing = &metricdata.TimeSeries{
+				LabelValues: labelValues,
+				Points:      copyPoints(ts.Points),
+				StartTime:   ts.StartTime,
+			}
+
+			merged[key] = existing
+			series = append(series, existing)
+			continue
+		}
+
+		if err := r.merge(m.Descriptor.Type, existing, ts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &metricdata.Metric{
+		Descriptor: descriptor,
+		Resource:   m.Resource,
+		TimeSeries: series,
+	}, nil
+}
+
+func labelValuesKey(labelValues []metricdata.LabelValue) string {
+	var b strings.Builder
+	for _, lv := range labelValues {
+		fmt.Fprintf(&b, "%t%q", lv.Present, lv.Value)
+	}
+
+	return b.String()
+}
+
+func copyPoints(points []metricdata.Point) []metricdata.Point {
+	res := make([]metricdata.Point, 0, len(points))
+
+	for _, p := range points {
+		if d, ok := p.Value.(*metricdata.Distribution); ok {
+			p.Value = copyDistribution(d)
+		}
+
+		res = append(res, p)
+	}
+
+	return res
+}
+
+func copyDistribution(d *metricdata.Distribution) *metricdata.Distribution {
+	res := *d
+	res.Buckets = append([]metricdata.Bucket{}, d.Buckets...)
+
+	return &res
+}
+
+func (r *rollupRule) merge(metricType metricdata.Type, into *metricdata.TimeSeries, ts *metricdata.TimeSeries) error {
+	if len(into.Points) != len(ts.Points) {
+		return errors.New("Merged series have a different number of points")
+	}
+
+	if !ts.StartTime.IsZero() && (into.StartTime.IsZero() || ts.StartTime.Before(into.StartTime)) {
+		into.StartTime = ts.StartTime
+	}
+
+	for i, p := range ts.Points {
+		merged, err := r.mergePoints(metricType, into.Points[i], p)
+		if err != nil {
+			return err
+		}
+
+		into.Points[i] = merged
+	}
+
+	return nil
+}
+
+func (r *rollupRule) mergePoints(metricType metricdata.Type, a metricdata.Point, b metricdata.Point) (metricdata.Point, error) {
+	res := metricdata.Point{Time: a.Time}
+	if b.Time.After(a.Time) {
+		res.Time = b.Time
+	}
+
+	switch metricType {
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+		sum, err := addValues(a.Value, b.Value)
+		if err != nil {
+			return res, err
+		}
+
+		res.Value = sum
+	case metricdata.TypeGaugeInt64, metricdata.TypeGaugeFloat64:
+		if r.gauge == GaugeMax {
+			greater, err := greaterValue(a.Value, b.Value)
+			if err != nil {
+				return res, err
+			}
+
+			res.Value = greater
+		} else if b.Time.Before(a.Time) {
+			res.Value = a.Value
+		} else {
+			res.Value = b.Value
+		}
+	case metricdata.TypeCumulativeDistribution, metricdata.TypeGaugeDistribution:
+		da, okA := a.Value.(*metricdata.Distribution)
+		db, okB := b.Value.(*metricdata.Distribution)
+		if !okA || !okB {
+			return res, errors.New("Unsupported value type")
+		}
+
+		merged, err := mergeDistributions(da, db)
+		if err != nil {
+			return res, err
+		}
+
+		res.Value = merged
+	default:
+		return res, errors.New("Unsupported metric type")
+	}
+
+	return res, nil
+}
+
+func addValues(a interface{}, b interface{}) (interface{}, error) {
+	switch va := a.(type) {
+	case int64:
+		if vb, ok := b.(int64); ok {
+			return va + vb, nil
+		}
+	case float64:
+		if vb, ok := b.(float64); ok {
+			return va + vb, nil
+		}
+	}
+
+	return nil, errors.New("Unsupported value type")
+}
+
+func greaterValue(a interface{}, b interface{}) (interface{}, error) {
+	switch va := a.(type) {
+	case int64:
+		if vb, ok := b.(int64); ok {
+			if vb > va {
+				return vb, nil
+			}
+			return va, nil
+		}
+	case float64:
+		if vb, ok := b.(float64); ok {
+			if vb > va {
+				return vb, nil
+			}
+			return va, nil
+		}
+	}
+
+	return nil, errors.New("Unsupported value type")
+}
+
+// mergeDistributions combines two distributions with the same bucket
+// bounds. The sum of squared deviation is combined with the parallel
+// variance formula so it matches the one of the union of both samples.
+func mergeDistributions(a *metricdata.Distribution, b *metricdata.Distribution) (*metricdata.Distribution, error) {
+	if !equalBounds(a.BucketOptions, b.BucketOptions) || len(a.Buckets) != len(b.Buckets) {
+		return nil, errors.New("Merged distributions have different buckets")
+	}
+
+	res := &metricdata.Distribution{
+		Count:                 a.Count + b.Count,
+		Sum:                   a.Sum + b.Sum,
+		SumOfSquaredDeviation: a.SumOfSquaredDeviation + b.SumOfSquaredDeviation,
+		BucketOptions:         a.BucketOptions,
+		Buckets:               make([]metricdata.Bucket, len(a.Buckets)),
+	}
+
+	if a.Count > 0 && b.Count > 0 {
+		delta := b.Sum/float64(b.Count) - a.Sum/float64(a.Count)
+		res.SumOfSquaredDeviation += delta * delta * float64(a.Count) * float64(b.Count) / float64(res.Count)
+	}
+
+	for i := range a.Buckets {
+		res.Buckets[i] = metricdata.Bucket{
+			Count:    a.Buckets[i].Count + b.Buckets[i].Count,
+			Exemplar: latestExemplar(a.Buckets[i].Exemplar, b.Buckets[i].Exemplar),
+		}
+	}
+
+	return res, nil
+}
+
+func equalBounds(a *metricdata.BucketOptions, b *metricdata.BucketOptions) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if len(a.Bounds) != len(b.Bounds) {
+		return false
+	}
+
+	for i := range a.Bounds {
+		if a.Bounds[i] != b.Bounds[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func latestExemplar(a *metricdata.Exemplar, b *metricdata.Exemplar) *metricdata.Exemplar {
+	if a == nil || (b != nil && b.Timestamp.After(a.Timestamp)) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+var (
+	topicKey     = metricdata.LabelKey{Key: "topic"}
+	partitionKey = metricdata.LabelKey{Key: "partition"}
+)
+
+func partitionedSeries(topic string, partition string, point metricdata.Point) *metricdata.TimeSeries {
+	return &metricdata.TimeSeries{
+		LabelValues: []metricdata.LabelValue{
+			metricdata.NewLabelValue(topic),
+			metricdata.NewLabelValue(partition),
+		},
+		Points:    []metricdata.Point{point},
+		StartTime: timeNow,
+	}
+}
+
+func partitionedMetric(metricType metricdata.Type, series ...*metricdata.TimeSeries) *metricdata.Metric {
+	return &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name:      dummyName,
+			Type:      metricType,
+			LabelKeys: []metricdata.LabelKey{topicKey, partitionKey},
+		},
+		TimeSeries: series,
+	}
+}
+
+func processRollup(t *testing.T, rule RollupRule, m *metricdata.Metric) *metricdata.Metric {
+	processor, err := NewRollup(rule)
+	if err != nil {
+		t.Fatalf("Error creating rollup: %v", err)
+	}
+
+	res, err := processor.Process([]*metricdata.Metric{m})
+	if err != nil {
+		t.Fatalf("Error processing rollup: %v", err)
+	}
+
+	if len(res) != 1 {
+		t.Fatalf("Rollup failed, expected 1 metric, got %v", len(res))
+	}
+
+	return res[0]
+}
+
+func TestRollupSumsCumulativeSeries(t *testing.T) {
+	m := partitionedMetric(metricdata.TypeCumulativeInt64,
+		partitionedSeries("a", "0", metricdata.NewInt64Point(timeNow, 1)),
+		partitionedSeries("a", "1", metricdata.NewInt64Point(timeNow, 2)),
+		partitionedSeries("b", "0", metricdata.NewInt64Point(timeNow, 4)),
+	)
+
+	got := processRollup(t, RollupRule{Filter: dummyName, DropLabels: []string{"partition"}}, m)
+
+	if len(got.Descriptor.LabelKeys) != 1 || got.Descriptor.LabelKeys[0] != topicKey {
+		t.Errorf("Rollup failed, expected label keys [%v], got %v", topicKey, got.Descriptor.LabelKeys)
+	}
+
+	want := map[string]int64{"a": 3, "b": 4}
+	if len(got.TimeSeries) != len(want) {
+		t.Fatalf("Rollup failed, expected %v series, got %v", len(want), len(got.TimeSeries))
+	}
+
+	for _, ts := range got.TimeSeries {
+		if val := ts.Points[0].Value.(int64); val != want[ts.LabelValues[0].Value] {
+			t.Errorf("Rollup failed for %v, expected %v, got %v", ts.LabelValues[0].Value, want[ts.LabelValues[0].Value], val)
+		}
+	}
+
+	if len(m.TimeSeries) != 3 || m.TimeSeries[0].Points[0].Value.(int64) != 1 {
+		t.Errorf("Rollup modified its input metric")
+	}
+}
+
+func TestRollupGauges(t *testing.T) {
+	later := timeNow.Add(time.Second)
+	m := partitionedMetric(metricdata.TypeGaugeFloat64,
+		partitionedSeries("a", "0", metricdata.NewFloat64Point(later, 1)),
+		partitionedSeries("a", "1", metricdata.NewFloat64Point(timeNow, 5)),
+	)
+
+	last := processRollup(t, RollupRule{Filter: dummyName, KeepLabels: []string{"topic"}}, m)
+	if val := last.TimeSeries[0].Points[0].Value.(float64); val != 1 {
+		t.Errorf("Rollup failed, expected last value 1, got %v", val)
+	}
+
+	greatest := processRollup(t, RollupRule{Filter: dummyName, KeepLabels: []string{"topic"}, Gauge: GaugeMax}, m)
+	if val := greatest.TimeSeries[0].Points[0].Value.(float64); val != 5 {
+		t.Errorf("Rollup failed, expected max value 5, got %v", val)
+	}
+}
+
+func distributionOf(bounds []float64, values ...float64) *metricdata.Distribution {
+	d := &metricdata.Distribution{
+		BucketOptions: &metricdata.BucketOptions{Bounds: bounds},
+		Buckets:       make([]metricdata.Bucket, len(bounds)+1),
+	}
+
+	for _, v := range values {
+		d.Count++
+		d.Sum += v
+		i := 0
+		for i < len(bounds) && v >= bounds[i] {
+			i++
+		}
+		d.Buckets[i].Count++
+	}
+
+	if d.Count > 0 {
+		mean := d.Sum / float64(d.Count)
+		for _, v := range values {
+			d.SumOfSquaredDeviation += (v - mean) * (v - mean)
+		}
+	}
+
+	return d
+}
+
+func TestRollupMergesDistributions(t *testing.T) {
+	bounds := []float64{1, 5, 10}
+	m := partitionedMetric(metricdata.TypeCumulativeDistribution,
+		partitionedSeries("a", "0", metricdata.NewDistributionPoint(timeNow, distributionOf(bounds, 0.5, 2, 3))),
+		partitionedSeries("a", "1", metricdata.NewDistributionPoint(timeNow, distributionOf(bounds, 7, 12))),
+	)
+
+	got := processRollup(t, RollupRule{Filter: dummyName, DropLabels: []string{"partition"}}, m)
+	gotDist := got.TimeSeries[0].Points[0].Value.(*metricdata.Distribution)
+	want := distributionOf(bounds, 0.5, 2, 3, 7, 12)
+
+	if gotDist.Count != want.Count || gotDist.Sum != want.Sum {
+		t.Errorf("Rollup failed, expected count %v and sum %v, got %v and %v", want.Count, want.Sum, gotDist.Count, gotDist.Sum)
+	}
+
+	if math.Abs(gotDist.SumOfSquaredDeviation-want.SumOfSquaredDeviation) > 1e-9 {
+		t.Errorf("Rollup failed, expected sum of squared deviation %v, got %v", want.SumOfSquaredDeviation, gotDist.SumOfSquaredDeviation)
+	}
+
+	for i := range want.Buckets {
+		if gotDist.Buckets[i].Count != want.Buckets[i].Count {
+			t.Errorf("Rollup failed, expected bucket %v count %v, got %v", i, want.Buckets[i].Count, gotDist.Buckets[i].Count)
+		}
+	}
+}
+
+func TestRollupMismatchedBuckets(t *testing.T) {
+	m := partitionedMetric(metricdata.TypeCumulativeDistribution,
+		partitionedSeries("a", "0", metricdata.NewDistributionPoint(timeNow, distributionOf([]float64{1}, 0.5))),
+		partitionedSeries("a", "1", metricdata.NewDistributionPoint(timeNow, distributionOf([]float64{2}, 0.5))),
+	)
+
+	processor, err := NewRollup(RollupRule{Filter: dummyName, DropLabels: []string{"partition"}})
+	if err != nil {
+		t.Fatalf("Error creating rollup: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	got, err := processor.Process([]*metricdata.Metric{m, metric})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatalf("Error processing metrics: %v", err)
+	}
+
+	// the metric is exported as is, and the others still rolled up
+	if len(got) != 2 || got[0] != m || got[1] == metric || got[1].Descriptor.Name != dummyName {
+		t.Errorf("Rollup failed, expected the unmergeable metric to pass through, got %v", got)
+	}
+
+	if !strings.Contains(logs.String(), "Error rolling up metric "+dummyName) {
+		t.Errorf("Rollup failed, expected the merge error to be logged, got %v", logs.String())
+	}
+}
@@ -0,0 +1,346 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+	schemaRegistryTimeout     = 10 * time.Second
+	schemaRegistryMagicByte   = 0
+)
+
+// SchemaRegistryConfig holds the configurations of a Confluent Schema
+// Registry. Subject defaults to the topic name followed by "-value".
+// Unless AutoRegister is set, the metrics proto schema (and the schemas
+// it imports, each under a subject named after its file) must already
+// be registered.
+type SchemaRegistryConfig struct {
+	URL          string
+	Username     string
+	Password     string
+	Subject      string
+	AutoRegister bool
+}
+
+// schemaRegistry looks up or registers the schemas of the Kafka
+// message payloads and frames them in the Schema Registry wire
+// format. The header of each message type is cached.
+type schemaRegistry struct {
+	config SchemaRegistryConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	headers map[protoreflect.FullName][]byte
+}
+
+func newSchemaRegistry(config SchemaRegistryConfig, topic string) *schemaRegistry {
+	if config.Subject == "" {
+		config.Subject = topic + "-value"
+	}
+
+	return &schemaRegistry{
+		config:  config,
+		client:  &http.Client{Timeout: schemaRegistryTimeout},
+		headers: map[protoreflect.FullName][]byte{},
+	}
+}
+
+// frame prefixes the payload with the magic byte, the schema ID
+// and the message indexes of the payload's message type.
+func (r *schemaRegistry) frame(md protoreflect.MessageDescriptor, payload []byte) ([]byte, error) {
+	header, err := r.header(md)
+	if err != nil {
+		return nil, err
+	}
+
+	framed := make([]byte, 0, len(header)+len(payload))
+	return append(append(framed, header...), payload...), nil
+}
+
+func (r *schemaRegistry) header(md protoreflect.MessageDescriptor) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if header, ok := r.headers[md.FullName()]; ok {
+		return header, nil
+	}
+
+	id, _, err := r.resolve(r.config.Subject, md.ParentFile())
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error resolving schema of %v", md.FullName()))
+	}
+
+	header := []byte{schemaRegistryMagicByte}
+	header = append(header, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(header[1:], uint32(id))
+	header = append(header, messageIndexes(md)...)
+
+	r.headers[md.FullName()] = header
+	return header, nil
+}
+
+// messageIndexes encodes the path of the message in its file as
+// zigzag varints, with the common path of the file's first
+// message shortened to a single zero.
+func messageIndexes(md protoreflect.MessageDescriptor) []byte {
+	indexes := []int{}
+	for d := protoreflect.Descriptor(md); d != nil; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+	}
+
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return []byte{0}
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	res := append([]byte{}, buf[:binary.PutVarint(buf, int64(len(indexes)))]...)
+	for _, index := range indexes {
+		res = append(res, buf[:binary.PutVarint(buf, int64(index))]...)
+	}
+
+	return res
+}
+
+type schemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type schemaRequest struct {
+	Schema     string            `json:"schema"`
+	SchemaType string            `json:"schemaType"`
+	References []schemaReference `json:"references,omitempty"`
+}
+
+type schemaResponse struct {
+	ID      int `json:"id"`
+	Version int `json:"version"`
+}
+
+// resolve returns the ID and version of the file's schema under the
+// subject, resolving its imports first. Well known types are built
+// into the registry and are not referenced.
+func (r *schemaRegistry) resolve(subject string, fd protoreflect.FileDescriptor) (int, int, error) {
+	request := schemaRequest{
+		Schema:     protoSchema(fd),
+		SchemaType: "PROTOBUF",
+	}
+
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		imported := imports.Get(i).FileDescriptor
+		if strings.HasPrefix(imported.Path(), "google/protobuf/") {
+			continue
+		}
+
+		_, version, err := r.resolve(imported.Path(), imported)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		request.References = append(request.References, schemaReference{
+			Name:    imported.Path(),
+			Subject: imported.Path(),
+			Version: version,
+		})
+	}
+
+	found, res, err := r.post("/subjects/"+url.PathEscape(subject), request)
+	if err != nil || found {
+		return res.ID, res.Version, err
+	}
+
+	if !r.config.AutoRegister {
+		return 0, 0, errors.Errorf("Schema of %v is not registered under subject %v", fd.Path(), subject)
+	}
+
+	if _, _, err := r.post("/subjects/"+url.PathEscape(subject)+"/versions", request); err != nil {
+		return 0, 0, err
+	}
+
+	// registering only returns the ID, look it up again for the version
+	found, res, err = r.post("/subjects/"+url.PathEscape(subject), request)
+	if err == nil && !found {
+		err = errors.Errorf("Schema of %v not found under subject %v after registering", fd.Path(), subject)
+	}
+
+	return res.ID, res.Version, err
+}
+
+// post sends the schema to the registry's path, returning false
+// if the registry responded that the subject or schema is unknown.
+func (r *schemaRegistry) post(path string, request schemaRequest) (bool, schemaResponse, error) {
+	res := schemaResponse{}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return false, res, errors.Wrap(err, "Error marshalling schema request")
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(r.config.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return false, res, errors.Wrap(err, "Error creating POST request")
+	}
+
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	if r.config.Username != "" {
+		req.SetBasicAuth(r.config.Username, r.config.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, res, errors.Wrap(err, "Error sending request to Schema Registry")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, res, errors.Wrap(err, "Error reading Schema Registry response")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, res, nil
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return false, res, errors.Errorf("Schema Registry responded with status %v: %s", resp.Status, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return false, res, errors.Wrap(err, "Error unmarshalling Schema Registry response")
+	}
+
+	return true, res, nil
+}
+
+// protoSchema prints the file's messages and enums as a .proto
+// schema. Options and services are left out, and type names are
+// fully qualified.
+func protoSchema(fd protoreflect.FileDescriptor) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "syntax = %q;\n", fd.Syntax().String())
+	if fd.Package() != "" {
+		fmt.Fprintf(&b, "package %v;\n", fd.Package())
+	}
+
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		fmt.Fprintf(&b, "import %q;\n", imports.Get(i).Path())
+	}
+
+	enums := fd.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		writeProtoEnum(&b, enums.Get(i), "")
+	}
+
+	messages := fd.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		writeProtoMessage(&b, messages.Get(i), "")
+	}
+
+	return b.String()
+}
+
+func writeProtoEnum(b *strings.Builder, ed protoreflect.EnumDescriptor, indent string) {
+	fmt.Fprintf(b, "%venum %v {\n", indent, ed.Name())
+
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		fmt.Fprintf(b, "%v  %v = %v;\n", indent, values.Get(i).Name(), values.Get(i).Number())
+	}
+
+	fmt.Fprintf(b, "%v}\n", indent)
+}
+
+func writeProtoMessage(b *strings.Builder, md protoreflect.MessageDescriptor, indent string) {
+	fmt.Fprintf(b, "%vmessage %v {\n", indent, md.Name())
+	inner := indent + "  "
+
+	enums := md.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		writeProtoEnum(b, enums.Get(i), inner)
+	}
+
+	messages := md.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		if !messages.Get(i).IsMapEntry() {
+			writeProtoMessage(b, messages.Get(i), inner)
+		}
+	}
+
+	// the fields of a oneof are printed together,
+	// where the first of them is declared
+	written := map[protoreflect.FullName]bool{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		oneof := field.ContainingOneof()
+		if oneof == nil || oneof.IsSynthetic() {
+			writeProtoField(b, field, inner)
+			continue
+		}
+
+		if written[oneof.FullName()] {
+			continue
+		}
+		written[oneof.FullName()] = true
+
+		fmt.Fprintf(b, "%voneof %v {\n", inner, oneof.Name())
+		oneofFields := oneof.Fields()
+		for j := 0; j < oneofFields.Len(); j++ {
+			writeProtoField(b, oneofFields.Get(j), inner+"  ")
+		}
+		fmt.Fprintf(b, "%v}\n", inner)
+	}
+
+	fmt.Fprintf(b, "%v}\n", indent)
+}
+
+func writeProtoField(b *strings.Builder, field protoreflect.FieldDescriptor, indent string) {
+	label := ""
+	switch {
+	case field.IsMap():
+	case field.Cardinality() == protoreflect.Repeated:
+		label = "repeated "
+	case field.HasOptionalKeyword():
+		label = "optional "
+	case field.Cardinality() == protoreflect.Required:
+		label = "required "
+	}
+
+	typeName := protoFieldType(field)
+	if field.IsMap() {
+		typeName = fmt.Sprintf("map<%v, %v>", protoFieldType(field.MapKey()), protoFieldType(field.MapValue()))
+	}
+
+	fmt.Fprintf(b, "%v%v%v %v = %v;\n", indent, label, typeName, field.Name(), field.Number())
+}
+
+func protoFieldType(field protoreflect.FieldDescriptor) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "." + string(field.Message().FullName())
+	case protoreflect.EnumKind:
+		return "." + string(field.Enum().FullName())
+	default:
+		return field.Kind().String()
+	}
+}
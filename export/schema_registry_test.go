@@ -0,0 +1,224 @@
+package export
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	r1 "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
+	"go.opencensus.io/metric/metricdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSchemaRegistry is an in-memory stand-in for the Schema
+// Registry's subject lookup and registration endpoints.
+type fakeSchemaRegistry struct {
+	mu       sync.Mutex
+	subjects map[string][]schemaRequest
+	ids      map[string]int
+	requests int
+}
+
+func newFakeSchemaRegistry() *fakeSchemaRegistry {
+	return &fakeSchemaRegistry{
+		subjects: map[string][]schemaRequest{},
+		ids:      map[string]int{},
+	}
+}
+
+func (f *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/subjects/")
+	register := strings.HasSuffix(path, "/versions")
+	subject, _ := url.PathUnescape(strings.TrimSuffix(path, "/versions"))
+
+	request := schemaRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i, registered := range f.subjects[subject] {
+		if registered.Schema == request.Schema {
+			json.NewEncoder(w).Encode(schemaResponse{ID: f.ids[request.Schema], Version: i + 1})
+			return
+		}
+	}
+
+	if !register {
+		http.Error(w, `{"error_code":40401}`, http.StatusNotFound)
+		return
+	}
+
+	for _, reference := range request.References {
+		if len(f.subjects[reference.Subject]) < reference.Version {
+			http.Error(w, `{"error_code":42201}`, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	if _, ok := f.ids[request.Schema]; !ok {
+		f.ids[request.Schema] = len(f.ids) + 1
+	}
+	f.subjects[subject] = append(f.subjects[subject], request)
+	json.NewEncoder(w).Encode(schemaResponse{ID: f.ids[request.Schema]})
+}
+
+func TestProtoSchema(t *testing.T) {
+	got := protoSchema((&r1.Resource{}).ProtoReflect().Descriptor().ParentFile())
+	want := `syntax = "proto3";
+package opencensus.proto.resource.v1;
+message Resource {
+  string type = 1;
+  map<string, string> labels = 2;
+}
+`
+
+	if got != want {
+		t.Errorf("Proto schema failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestSchemaRegistryFrame(t *testing.T) {
+	registry := newFakeSchemaRegistry()
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	exporter := Kafka{
+		config: config,
+		topicInfo: TopicConfig{
+			Topic:          topicName,
+			SchemaRegistry: &SchemaRegistryConfig{URL: server.URL, AutoRegister: true},
+		},
+		schemaRegistry: newSchemaRegistry(SchemaRegistryConfig{URL: server.URL, AutoRegister: true}, topicName),
+	}
+
+	payloads, err := exporter.messagePayloads(metrics, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	md := exporter.config.payloadDescriptor(false)
+	if len(registry.subjects[topicName+"-value"]) != 1 || len(registry.subjects["opencensus/proto/resource/v1/resource.proto"]) != 1 {
+		t.Errorf("Schema registry frame failed, expected schemas to be registered, got subjects %v", registry.subjects)
+	}
+
+	id := registry.ids[protoSchema(md.ParentFile())]
+	indexes := messageIndexes(md)
+	payload := payloads[0].body
+	if payload[0] != schemaRegistryMagicByte || binary.BigEndian.Uint32(payload[1:5]) != uint32(id) {
+		t.Fatalf("Schema registry frame failed, expected schema ID %v, got header %v", id, payload[:5])
+	}
+
+	pb, err := exporter.config.metricToMessage(metric, nil)
+	if err != nil {
+		t.Fatalf("Error converting metric to Proto: %v", err)
+	}
+
+	want, _ := proto.Marshal(pb)
+	if got := payload[5+len(indexes):]; string(got) != string(want) {
+		t.Errorf("Schema registry frame failed, expected payload %v, got %v", want, got)
+	}
+
+	// the header is cached after the first lookup
+	requests := registry.requests
+	if _, err := exporter.messagePayloads(metrics, nil); err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	if registry.requests != requests {
+		t.Errorf("Schema registry frame failed, expected cached schema ID, got %v more requests", registry.requests-requests)
+	}
+}
+
+func TestSchemaRegistryFrameMaxPayloadBytes(t *testing.T) {
+	server := httptest.NewServer(newFakeSchemaRegistry())
+	defer server.Close()
+
+	unframed := Kafka{config: config, topicInfo: topicInfo}
+	payloads, err := unframed.messagePayloads([]*metricdata.Metric{largeMetric(40)}, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	// the cap fits the unframed payload, but not the framing header
+	capped := config
+	capped.MaxPayloadBytes = len(payloads[0].body)
+	exporter := Kafka{
+		config:         capped,
+		topicInfo:      topicInfo,
+		schemaRegistry: newSchemaRegistry(SchemaRegistryConfig{URL: server.URL, AutoRegister: true}, topicName),
+	}
+
+	payloads, err = exporter.messagePayloads([]*metricdata.Metric{largeMetric(40)}, nil)
+	if err != nil {
+		t.Fatalf("Error encoding message payloads: %v", err)
+	}
+
+	if len(payloads) < 2 {
+		t.Errorf("Schema registry frame failed, expected the framed metric to be split, got %v messages", len(payloads))
+	}
+
+	for _, payload := range payloads {
+		if len(payload.body) > capped.MaxPayloadBytes || payload.body[0] != schemaRegistryMagicByte {
+			t.Errorf("Schema registry frame failed, expected framed messages of at most %v bytes, got %v", capped.MaxPayloadBytes, len(payload.body))
+		}
+	}
+}
+
+func TestNewKafkaSchemaRegistryStructuredCloudEvents(t *testing.T) {
+	ceConfig := config
+	ceConfig.CloudEvents = CloudEventsConfig{Mode: StructuredCloudEvents}
+
+	_, err := NewKafkaWithConfig(KafkaConfig{
+		Producer: kafkaConfig,
+		Topic:    TopicConfig{Topic: topicName, SchemaRegistry: &SchemaRegistryConfig{URL: "http://localhost:8081"}},
+	}, ceConfig)
+	if err == nil {
+		t.Errorf("Expected error combining Schema Registry framing with structured CloudEvents")
+	}
+}
+
+func TestSchemaRegistryNotRegistered(t *testing.T) {
+	server := httptest.NewServer(newFakeSchemaRegistry())
+	defer server.Close()
+
+	exporter := Kafka{
+		config:         config,
+		topicInfo:      topicInfo,
+		schemaRegistry: newSchemaRegistry(SchemaRegistryConfig{URL: server.URL}, topicName),
+	}
+
+	if _, err := exporter.messagePayloads(metrics, nil); err == nil {
+		t.Errorf("Expected error framing payload with an unregistered schema")
+	}
+}
+
+func TestMessageIndexes(t *testing.T) {
+	// indexes are zigzag encoded, and prefixed by their count
+	// unless the message is the first of its file
+	tests := []struct {
+		md   proto.Message
+		want []byte
+	}{
+		{&v1.Metric{}, []byte{0}},
+		{&v1.TimeSeries{}, []byte{2, 6}},
+		{&v1.DistributionValue_Exemplar{}, []byte{4, 12, 4}},
+	}
+
+	for _, test := range tests {
+		md := test.md.ProtoReflect().Descriptor()
+		if got := messageIndexes(md); string(got) != string(test.want) {
+			t.Errorf("Message indexes failed for %v, expected %v, got %v", md.FullName(), test.want, got)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+const (
+	defaultStatsDMTU    = 1432
+	statsDDialTimeout   = 10 * time.Second
+	statsDInvalidChars  = ":|@#\n"
+	statsDTagSeparators = ",|#\n"
+)
+
+// StatsDConfig holds the configurations of a StatsD agent. Network
+// is "udp" (the default) or "unixgram", and Address is the agent's
+// host:port or socket path. Metric names are prefixed with Prefix.
+// Labels are sent as tags to DogStatsD agents, and appended to the
+// metric name otherwise. Datagrams are batched up to MTU bytes.
+type StatsDConfig struct {
+	Network   string
+	Address   string
+	Prefix    string
+	DogStatsD bool
+	MTU       int
+}
+
+// StatsD is an exporter that exports metrics as StatsD or DogStatsD
+// datagrams. Gauges are sent as gauges, cumulative counters as
+// counters of their increase since the previous export, and
+// distributions as count and sum counters and percentile gauges.
+type StatsD struct {
+	statsDConfig StatsDConfig
+	deltas       *deltaTracker
+	config       Config
+}
+
+// NewStatsD returns a new exporter agent with a StatsD exporter attached
+func NewStatsD(statsDConfig StatsDConfig, config Config) (*ExporterAgent, error) {
+	switch statsDConfig.Network {
+	case "":
+		statsDConfig.Network = "udp"
+	case "udp", "unixgram":
+	default:
+		return nil, errors.Errorf("Unsupported StatsD network %v", statsDConfig.Network)
+	}
+
+	if statsDConfig.MTU <= 0 {
+		statsDConfig.MTU = defaultStatsDMTU
+	}
+
+	exporter := StatsD{
+		statsDConfig: statsDConfig,
+		deltas:       newDeltaTracker(),
+		config:       config,
+	}
+
+	agent := newExporterAgent(exporter, exporter.config)
+	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
+		return nil, errors.Wrap(err, "Couldn't Start Exporter")
+	}
+
+	return agent, nil
+}
+
+// ExportMetrics converts the metrics to StatsD lines and sends
+// them to the agent in as few datagrams as the MTU allows.
+func (e StatsD) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	filter, err := e.config.newMetricFilter()
+	if err != nil {
+		return errors.Wrap(err, "Error creating metric filter")
+	}
+
+	defer e.deltas.prune()
+
+	lines := []string{}
+	for _, d := range data {
+		if !filter.matches(d.Descriptor.Name) {
+			continue
+		}
+
+		metricLines, err := e.metricToStatsD(d)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error converting metric %v to StatsD", d.Descriptor.Name))
+		}
+
+		lines = append(lines, metricLines...)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := e.send(ctx, lines); err != nil {
+		return errors.Wrap(err, "Error sending metrics")
+	}
+
+	return nil
+}
+
+func (e StatsD) send(ctx context.Context, lines []string) error {
+	dialer := net.Dialer{Timeout: statsDDialTimeout}
+	conn, err := dialer.DialContext(ctx, e.statsDConfig.Network, e.statsDConfig.Address)
+	if err != nil {
+		return errors.Wrap(err, "Error connecting to StatsD agent")
+	}
+	defer conn.Close()
+
+	for _, packet := range batchLines(lines, e.statsDConfig.MTU) {
+		if _, err := conn.Write(packet); err != nil {
+			return errors.Wrap(err, "Error writing to StatsD agent")
+		}
+	}
+
+	return nil
+}
+
+// batchLines joins the lines into packets of at most maxBytes.
+// Lines longer than maxBytes are sent in a packet of their own.
+func batchLines(lines []string, maxBytes int) [][]byte {
+	packets := [][]byte{}
+	var buf bytes.Buffer
+
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxBytes {
+			packets = append(packets, append([]byte{}, buf.Bytes()...))
+			buf.Reset()
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+
+	return packets
+}
+
+func sanitizeStatsD(s string, invalid string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalid, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// statsDSeries holds the name and tags of a time series.
+type statsDSeries struct {
+	key  string
+	name string
+	tags string
+}
+
+func (e StatsD) timeSeriesToStatsD(m *metricdata.Metric, ts *metricdata.TimeSeries) statsDSeries {
+	name := m.Descriptor.Name
+	if e.statsDConfig.Prefix != "" {
+		name = e.statsDConfig.Prefix + "." + name
+	}
+
+	tags := []string{}
+	for i, lv := range ts.LabelValues {
+		if !lv.Present || i >= len(m.Descriptor.LabelKeys) {
+			continue
+		}
+
+		if e.statsDConfig.DogStatsD {
+			tags = append(tags, sanitizeStatsD(m.Descriptor.LabelKeys[i].Key, statsDTagSeparators+":")+":"+sanitizeStatsD(lv.Value, statsDTagSeparators))
+		} else {
+			name += "." + lv.Value
+		}
+	}
+
+	series := statsDSeries{
+		key:  fmt.Sprintf("%q%v", m.Descriptor.Name, labelValuesKey(ts.LabelValues)),
+		name: sanitizeStatsD(name, statsDInvalidChars),
+	}
+
+	if len(tags) != 0 {
+		sort.Strings(tags)
+		series.tags = "|#" + strings.Join(tags, ",")
+	}
+
+	return series
+}
+
+func (s statsDSeries) line(suffix string, value string, statsDType string) string {
+	return s.name + suffix + ":" + value + "|" + statsDType + s.tags
+}
+
+// gaugeLines sets the gauge to the value. Plain StatsD reads a signed
+// gauge value as a change of the gauge, so a negative value is set
+// by first resetting the gauge to zero.
+func (e StatsD) gaugeLines(s statsDSeries, suffix string, value float64) []string {
+	line := s.line(suffix, formatFloat(value), "g")
+	if value < 0 && !e.statsDConfig.DogStatsD {
+		return []string{s.line(suffix, "0", "g"), line}
+	}
+
+	return []string{line}
+}
+
+func (e StatsD) metricToStatsD(m *metricdata.Metric) ([]string, error) {
+	lines := []string{}
+	cumulative := m.Descriptor.Type == metricdata.TypeCumulativeInt64 ||
+		m.Descriptor.Type == metricdata.TypeCumulativeFloat64 ||
+		m.Descriptor.Type == metricdata.TypeCumulativeDistribution
+
+	for _, ts := range m.TimeSeries {
+		series := e.timeSeriesToStatsD(m, ts)
+
+		for _, p := range ts.Points {
+			switch v := p.Value.(type) {
+			case int64, float64:
+				value, err := pointToFloat64(p)
+				if err != nil {
+					return nil, err
+				}
+
+				if !cumulative {
+					lines = append(lines, e.gaugeLines(series, "", value)...)
+				} else if delta, _, ok := e.deltas.value(series.key, ts.StartTime, p.Time, value); ok {
+					lines = append(lines, series.line("", formatFloat(delta), "c"))
+				}
+			case *metricdata.Distribution:
+				d := v
+				if cumulative {
+					var ok bool
+					if d, ok = e.deltas.distribution(series.key, ts.StartTime, p.Time, v); !ok {
+						continue
+					}
+				}
+
+				// only the deltas of cumulative distributions add up
+				// across flushes, snapshots are sent as gauges
+				if cumulative {
+					lines = append(lines,
+						series.line(".count", strconv.FormatInt(d.Count, 10), "c"),
+						series.line(".sum", formatFloat(d.Sum), "c"),
+					)
+				} else {
+					lines = append(lines, e.gaugeLines(series, ".count", float64(d.Count))...)
+					lines = append(lines, e.gaugeLines(series, ".sum", d.Sum)...)
+				}
+
+				if d.Count > 0 {
+					for _, percentile := range defaultPercentiles {
+						lines = append(lines, e.gaugeLines(series, ".p"+formatFloat(percentile), estimatePercentile(d, percentile))...)
+					}
+				}
+			case *metricdata.Summary:
+				if count, _, ok := e.deltas.value(series.key+".count", ts.StartTime, p.Time, float64(v.Count)); ok {
+					lines = append(lines, series.line(".count", formatFloat(count), "c"))
+				}
+
+				if sum, _, ok := e.deltas.value(series.key+".sum", ts.StartTime, p.Time, v.Sum); ok {
+					lines = append(lines, series.line(".sum", formatFloat(sum), "c"))
+				}
+
+				for _, percentile := range sortedPercentiles(v) {
+					lines = append(lines, e.gaugeLines(series, ".p"+formatFloat(percentile), v.Snapshot.Percentiles[percentile])...)
+				}
+			default:
+				return nil, errors.New("Unsupported value type")
+			}
+		}
+	}
+
+	return lines, nil
+}
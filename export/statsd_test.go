@@ -0,0 +1,194 @@
+package export
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestBatchLines(t *testing.T) {
+	got := batchLines([]string{"aaaa", "bbbb", "cccc", "dddddddddddd"}, 10)
+	want := [][]byte{[]byte("aaaa\nbbbb"), []byte("cccc"), []byte("dddddddddddd")}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Batch lines failed, expected %q, got %q", want, got)
+	}
+}
+
+func TestStatsDGauge(t *testing.T) {
+	gauge := renamed(metric, "queue.size")
+	gauge.Descriptor.Type = metricdata.TypeGaugeInt64
+
+	exporter := StatsD{
+		statsDConfig: StatsDConfig{Prefix: "app", DogStatsD: true},
+		deltas:       newDeltaTracker(),
+	}
+
+	got, err := exporter.metricToStatsD(gauge)
+	if err != nil {
+		t.Fatalf("Error converting metric to StatsD: %v", err)
+	}
+
+	want := []string{"app.queue.size:10|g|#Key:Val"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Metric to StatsD failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestStatsDNegativeGauge(t *testing.T) {
+	gauge := renamed(metric, "temperature")
+	gauge.Descriptor.Type = metricdata.TypeGaugeInt64
+	gauge.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{Points: []metricdata.Point{metricdata.NewInt64Point(timeNow, -5)}},
+	}
+
+	tests := []struct {
+		dogStatsD bool
+		want      []string
+	}{
+		// plain StatsD reads -5 as a decrement, the gauge is reset first
+		{false, []string{"temperature:0|g", "temperature:-5|g"}},
+		{true, []string{"temperature:-5|g"}},
+	}
+
+	for _, test := range tests {
+		exporter := StatsD{
+			statsDConfig: StatsDConfig{DogStatsD: test.dogStatsD},
+			deltas:       newDeltaTracker(),
+		}
+
+		got, err := exporter.metricToStatsD(gauge)
+		if err != nil {
+			t.Fatalf("Error converting metric to StatsD: %v", err)
+		}
+
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("Metric to StatsD failed with DogStatsD %v, expected %v, got %v", test.dogStatsD, test.want, got)
+		}
+	}
+}
+
+func TestStatsDPruneDeltas(t *testing.T) {
+	exporter := StatsD{deltas: newDeltaTracker()}
+
+	exporter.metricToStatsD(counterAt(timeNow, timeNow, 10))
+	exporter.metricToStatsD(renamed(counterAt(timeNow.Add(deltaStaleAge+time.Second), timeNow, 10), "other"))
+	exporter.deltas.prune()
+
+	if _, ok := exporter.deltas.values[`"other"`]; !ok || len(exporter.deltas.values) != 1 {
+		t.Errorf("Delta pruning failed, expected only the recent series to be kept, got %v", exporter.deltas.values)
+	}
+}
+
+func TestStatsDCounterDelta(t *testing.T) {
+	exporter := StatsD{deltas: newDeltaTracker()}
+
+	if got, _ := exporter.metricToStatsD(counterAt(timeNow, timeNow, 10)); len(got) != 0 {
+		t.Errorf("Metric to StatsD failed, expected first observation to be skipped, got %v", got)
+	}
+
+	got, err := exporter.metricToStatsD(counterAt(timeNow.Add(time.Second), timeNow, 25))
+	if err != nil {
+		t.Fatalf("Error converting metric to StatsD: %v", err)
+	}
+
+	if want := []string{dummyName + ":15|c"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("Metric to StatsD failed, expected %v, got %v", want, got)
+	}
+
+	got, _ = exporter.metricToStatsD(counterAt(timeNow.Add(2*time.Second), timeNow, 5))
+	if want := []string{dummyName + ":5|c"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("Metric to StatsD failed after reset, expected %v, got %v", want, got)
+	}
+}
+
+func TestStatsDDistributionDelta(t *testing.T) {
+	bounds := []float64{1, 5, 10}
+	distributionAt := func(values ...float64) *metricdata.Metric {
+		m := renamed(distributionMetric, "latency")
+		m.TimeSeries = []*metricdata.TimeSeries{
+			&metricdata.TimeSeries{
+				Points:    []metricdata.Point{metricdata.NewDistributionPoint(timeNow, distributionOf(bounds, values...))},
+				StartTime: timeNow,
+			},
+		}
+		return m
+	}
+
+	exporter := StatsD{deltas: newDeltaTracker()}
+	exporter.metricToStatsD(distributionAt(2, 3))
+
+	got, err := exporter.metricToStatsD(distributionAt(2, 3, 7, 8))
+	if err != nil {
+		t.Fatalf("Error converting metric to StatsD: %v", err)
+	}
+
+	if len(got) != 2+len(defaultPercentiles) || got[0] != "latency.count:2|c" || got[1] != "latency.sum:15|c" {
+		t.Errorf("Metric to StatsD failed, got %v", got)
+	}
+
+	for _, line := range got[2:] {
+		if !strings.HasSuffix(line, "|g") {
+			t.Errorf("Metric to StatsD failed, expected percentile gauge, got %v", line)
+		}
+	}
+}
+
+func TestStatsDGaugeDistribution(t *testing.T) {
+	m := renamed(distributionMetric, "latency")
+	m.Descriptor.Type = metricdata.TypeGaugeDistribution
+	m.TimeSeries = []*metricdata.TimeSeries{
+		&metricdata.TimeSeries{
+			Points: []metricdata.Point{metricdata.NewDistributionPoint(timeNow, distributionOf([]float64{1, 5, 10}, 2, 3))},
+		},
+	}
+
+	// snapshots would be added up across flushes as counters
+	exporter := StatsD{deltas: newDeltaTracker()}
+	for i := 0; i < 2; i++ {
+		got, err := exporter.metricToStatsD(m)
+		if err != nil {
+			t.Fatalf("Error converting metric to StatsD: %v", err)
+		}
+
+		if len(got) != 2+len(defaultPercentiles) || got[0] != "latency.count:2|g" || got[1] != "latency.sum:5|g" {
+			t.Errorf("Metric to StatsD failed, expected count and sum gauges, got %v", got)
+		}
+	}
+}
+
+func TestStatsDExportMetrics(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening on UDP: %v", err)
+	}
+	defer conn.Close()
+
+	gauge := renamed(metric, dummyName)
+	gauge.Descriptor.Type = metricdata.TypeGaugeInt64
+
+	exporter := StatsD{
+		statsDConfig: StatsDConfig{Network: "udp", Address: conn.LocalAddr().String(), MTU: defaultStatsDMTU},
+		deltas:       newDeltaTracker(),
+		config:       config,
+	}
+
+	if err := exporter.ExportMetrics(context.Background(), []*metricdata.Metric{gauge}); err != nil {
+		t.Fatalf("Error exporting metrics to StatsD: %v", err)
+	}
+
+	buf := make([]byte, defaultStatsDMTU)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Error reading UDP datagram: %v", err)
+	}
+
+	if got, want := string(buf[:n]), dummyName+".Val:10|g"; got != want {
+		t.Errorf("StatsD export failed, expected %v, got %v", want, got)
+	}
+}
@@ -19,7 +19,7 @@ func NewStdout(config Config) (*ExporterAgent, error) {
 		config: config,
 	}
 
-	agent := newExporterAgent(exporter)
+	agent := newExporterAgent(exporter, exporter.config)
 	if err := agent.Start(exporter.config.reportingPeriodMilliseconds); err != nil {
 		return nil, errors.Wrap(err, "Couldn't Start Exporter")
 	}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -50,7 +51,7 @@ func TestStdoutExportMetrics(t *testing.T) {
 }
 
 func compareStdout(t *testing.T, want Stdout, got Stdout) {
-	if want.config != got.config {
+	if !reflect.DeepEqual(want.config, got.config) {
 		t.Errorf("New Stdout failed, expected config %v, got %v", want.config, got.config)
 	}
 }
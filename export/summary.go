@@ -0,0 +1,181 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/metric/metricdata"
+)
+
+var defaultPercentiles = []float64{50, 95, 99}
+
+type summaryConversion struct {
+	filter      *regexp.Regexp
+	percentiles []float64
+}
+
+// NewSummaryConversion returns a Processor that converts the
+// distributions whose names match filter into summaries. The
+// percentiles (in the range (0, 100]) are estimated from the
+// distribution buckets, count and sum are kept exact. It defaults
+// to the 50th, 95th and 99th percentiles.
+func NewSummaryConversion(filter string, percentiles ...float64) (Processor, error) {
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error compiling summary conversion filter %v", filter))
+	}
+
+	if len(percentiles) == 0 {
+		percentiles = defaultPercentiles
+	}
+
+	for _, p := range percentiles {
+		if p <= 0 || p > 100 {
+			return nil, errors.Errorf("Invalid percentile %v", p)
+		}
+	}
+
+	return &summaryConversion{
+		filter:      re,
+		percentiles: percentiles,
+	}, nil
+}
+
+// Process converts the matching distributions to summaries.
+func (s *summaryConversion) Process(data []*metricdata.Metric) ([]*metricdata.Metric, error) {
+	res := make([]*metricdata.Metric, 0, len(data))
+
+	for _, d := range data {
+		if !isDistribution(d.Descriptor.Type) || !s.filter.MatchString(d.Descriptor.Name) {
+			res = append(res, d)
+			continue
+		}
+
+		converted, err := s.convert(d)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error converting metric %v to summary", d.Descriptor.Name))
+		}
+
+		res = append(res, converted)
+	}
+
+	return res, nil
+}
+
+func isDistribution(metricType metricdata.Type) bool {
+	return metricType == metricdata.TypeCumulativeDistribution || metricType == metricdata.TypeGaugeDistribution
+}
+
+func (s *summaryConversion) convert(m *metricdata.Metric) (*metricdata.Metric, error) {
+	descriptor := m.Descriptor
+	descriptor.Type = metricdata.TypeSummary
+
+	timeSeries := []*metricdata.TimeSeries{}
+	for _, ts := range m.TimeSeries {
+		points := []metricdata.Point{}
+
+		for _, p := range ts.Points {
+			d, ok := p.Value.(*metricdata.Distribution)
+			if !ok {
+				return nil, errors.New("Unsupported value type")
+			}
+
+			points = append(points, metricdata.NewSummaryPoint(p.Time, s.distributionToSummary(d)))
+		}
+
+		timeSeries = append(timeSeries, &metricdata.TimeSeries{
+			LabelValues: ts.LabelValues,
+			Points:      points,
+			StartTime:   ts.StartTime,
+		})
+	}
+
+	return &metricdata.Metric{
+		Descriptor: descriptor,
+		Resource:   m.Resource,
+		TimeSeries: timeSeries,
+	}, nil
+}
+
+func (s *summaryConversion) distributionToSummary(d *metricdata.Distribution) *metricdata.Summary {
+	percentiles := map[float64]float64{}
+	if d.Count > 0 {
+		for _, p := range s.percentiles {
+			percentiles[p] = estimatePercentile(d, p)
+		}
+	}
+
+	return &metricdata.Summary{
+		Count:          d.Count,
+		Sum:            d.Sum,
+		HasCountAndSum: true,
+		Snapshot: metricdata.Snapshot{
+			Count:       d.Count,
+			Sum:         d.Sum,
+			Percentiles: percentiles,
+		},
+	}
+}
+
+// estimatePercentile finds the bucket holding the percentile and
+// interpolates linearly between its bounds. The first bucket is
+// assumed to start at zero unless its bound is negative, and
+// percentiles falling in the overflow bucket are capped at the
+// highest bound.
+func estimatePercentile(d *metricdata.Distribution, percentile float64) float64 {
+	var bounds []float64
+	if d.BucketOptions != nil {
+		bounds = d.BucketOptions.Bounds
+	}
+
+	if len(bounds) == 0 || len(d.Buckets) == 0 {
+		return d.Sum / float64(d.Count)
+	}
+
+	rank := percentile / 100 * float64(d.Count)
+	cumulative := int64(0)
+
+	for i, b := range d.Buckets {
+		if b.Count == 0 || float64(cumulative+b.Count) < rank {
+			cumulative += b.Count
+			continue
+		}
+
+		if i >= len(bounds) {
+			return bounds[len(bounds)-1]
+		}
+
+		upper := bounds[i]
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		} else if upper < 0 {
+			return upper
+		}
+
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(b.Count)
+	}
+
+	return bounds[len(bounds)-1]
+}
+
+// sortedPercentiles returns the percentiles of the summary's
+// snapshot in increasing order.
+func sortedPercentiles(s *metricdata.Summary) []float64 {
+	percentiles := make([]float64, 0, len(s.Snapshot.Percentiles))
+	for percentile := range s.Snapshot.Percentiles {
+		percentiles = append(percentiles, percentile)
+	}
+	sort.Float64s(percentiles)
+
+	return percentiles
+}
+
+// formatFloat formats the value in decimal notation, without
+// trailing zeros, for the plain text protocols.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
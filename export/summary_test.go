@@ -0,0 +1,103 @@
+package export
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	v1 "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	"go.opencensus.io/metric/metricdata"
+)
+
+var (
+	summaryDistribution = &metricdata.Distribution{
+		Count:         30,
+		Sum:           450,
+		BucketOptions: &metricdata.BucketOptions{Bounds: []float64{10, 20, 30}},
+		Buckets: []metricdata.Bucket{
+			{Count: 10}, {Count: 10}, {Count: 10}, {Count: 0},
+		},
+	}
+
+	distributionMetric = &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name: dummyName,
+			Type: metricdata.TypeCumulativeDistribution,
+		},
+		TimeSeries: []*metricdata.TimeSeries{
+			&metricdata.TimeSeries{
+				Points:    []metricdata.Point{metricdata.NewDistributionPoint(timeNow, summaryDistribution)},
+				StartTime: timeNow,
+			},
+		},
+	}
+)
+
+func TestEstimatePercentile(t *testing.T) {
+	want := map[float64]float64{50: 15, 99: 29.7, 100: 30}
+
+	for p, val := range want {
+		if got := estimatePercentile(summaryDistribution, p); math.Abs(got-val) > 1e-9 {
+			t.Errorf("Estimate percentile failed for p%v, expected %v, got %v", p, val, got)
+		}
+	}
+}
+
+func TestSummaryConversion(t *testing.T) {
+	processor, err := NewSummaryConversion(dummyName)
+	if err != nil {
+		t.Fatalf("Error creating summary conversion: %v", err)
+	}
+
+	res, err := processor.Process([]*metricdata.Metric{distributionMetric})
+	if err != nil {
+		t.Fatalf("Error converting distribution to summary: %v", err)
+	}
+
+	if res[0].Descriptor.Type != metricdata.TypeSummary {
+		t.Errorf("Summary conversion failed, expected type %v, got %v", metricdata.TypeSummary, res[0].Descriptor.Type)
+	}
+
+	if distributionMetric.Descriptor.Type != metricdata.TypeCumulativeDistribution {
+		t.Errorf("Summary conversion modified its input metric")
+	}
+
+	pb, err := metricToProto(res[0])
+	if err != nil {
+		t.Fatalf("Error converting metric to Proto: %v", err)
+	}
+
+	summary := pb.Timeseries[0].Points[0].Value.(*v1.Point_SummaryValue).SummaryValue
+	if summary.Count.Value != summaryDistribution.Count || summary.Sum.Value != summaryDistribution.Sum {
+		t.Errorf("Summary conversion failed, expected count %v and sum %v, got %v and %v",
+			summaryDistribution.Count, summaryDistribution.Sum, summary.Count.Value, summary.Sum.Value)
+	}
+
+	if len(summary.Snapshot.PercentileValues) != len(defaultPercentiles) {
+		t.Errorf("Summary conversion failed, expected %v percentiles, got %v", len(defaultPercentiles), len(summary.Snapshot.PercentileValues))
+	}
+}
+
+func TestSummaryConversionInvalidPercentile(t *testing.T) {
+	if _, err := NewSummaryConversion(dummyName, 0); err == nil {
+		t.Errorf("Expected error for invalid percentile")
+	}
+}
+
+func TestSortedPercentiles(t *testing.T) {
+	s := &metricdata.Summary{Snapshot: metricdata.Snapshot{Percentiles: map[float64]float64{99: 3, 50: 1, 99.9: 4, 95: 2}}}
+
+	if got, want := sortedPercentiles(s), []float64{50, 95, 99, 99.9}; !reflect.DeepEqual(want, got) {
+		t.Errorf("Sorted percentiles failed, expected %v, got %v", want, got)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := map[float64]string{10: "10", 99.9: "99.9", -0.5: "-0.5", 1e21: "1000000000000000000000"}
+
+	for v, want := range tests {
+		if got := formatFloat(v); got != want {
+			t.Errorf("Format float failed, expected %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package export
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TLSConfig holds the TLS configurations of a connection. CAFile
+// holds the PEM bundle of the CAs trusted to sign the server's
+// certificate, in place of the system's, and CertFile and KeyFile
+// the PEM client certificate and key presented for mutual TLS.
+// ServerName overrides the name the server's certificate is
+// verified against, and MinVersion (such as tls.VersionTLS12) the
+// lowest accepted TLS version. If ReloadCertificates is set, the
+// client certificate is read again from disk on handshakes after
+// its files were modified, and the CA bundle on requests after its
+// file was modified.
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	MinVersion         uint16
+	ReloadCertificates bool
+}
+
+// clientConfig builds the crypto/tls configuration of a client.
+func (c TLSConfig) clientConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: c.MinVersion,
+	}
+
+	switch c.MinVersion {
+	case 0, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+	default:
+		return nil, errors.Errorf("Unsupported TLS version %#x", c.MinVersion)
+	}
+
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("Client certificate requires both a certificate and a key file")
+	}
+
+	if c.CertFile != "" {
+		keyPair := &keyPairReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+		if err := keyPair.reload(); err != nil {
+			return nil, err
+		}
+
+		if c.ReloadCertificates {
+			tlsConfig.GetClientCertificate = keyPair.getClientCertificate
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{*keyPair.cert}
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCertPool reads the PEM bundle of CAs in the file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	ca, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading CA file")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("No certificates found in CA file %v", file)
+	}
+
+	return pool, nil
+}
+
+// caReloadingTransport sends requests through a copy of its transport
+// trusting the CAs in the CA file, rebuilt whenever the file was
+// modified. The previous transport's connections are left to finish
+// their requests.
+type caReloadingTransport struct {
+	caFile string
+
+	mu        sync.Mutex
+	transport *http.Transport
+	modTime   time.Time
+}
+
+func newCAReloadingTransport(caFile string, transport *http.Transport) (*caReloadingTransport, error) {
+	t := &caReloadingTransport{caFile: caFile, transport: transport}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// RoundTrip sends the request through the current transport.
+func (t *caReloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	// a bundle caught halfway through its rotation fails to
+	// load, keep trusting the previous one until it's done
+	if err := t.reload(); err != nil {
+		log.Printf("Error reloading CA file: %v", err)
+	}
+	transport := t.transport
+	t.mu.Unlock()
+
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the current transport's idle connections.
+func (t *caReloadingTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transport.CloseIdleConnections()
+}
+
+func (t *caReloadingTransport) reload() error {
+	info, err := os.Stat(t.caFile)
+	if err != nil {
+		return errors.Wrap(err, "Error reading CA file")
+	}
+
+	if info.ModTime().Equal(t.modTime) {
+		return nil
+	}
+
+	pool, err := loadCertPool(t.caFile)
+	if err != nil {
+		return err
+	}
+
+	transport := t.transport.Clone()
+	transport.TLSClientConfig.RootCAs = pool
+
+	t.transport.CloseIdleConnections()
+	t.transport = transport
+	t.modTime = info.ModTime()
+	return nil
+}
+
+// keyPairReloader holds a certificate and its key, read
+// again whenever either of their files was modified.
+type keyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func (k *keyPairReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// a pair caught halfway through its rotation fails to
+	// load, keep presenting the previous one until it's done
+	modTimes, err := k.stat()
+	if err == nil && modTimes != k.modTimes {
+		err = k.load(modTimes)
+	}
+
+	if err != nil {
+		log.Printf("Error reloading client certificate: %v", err)
+	}
+
+	return k.cert, nil
+}
+
+func (k *keyPairReloader) reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	modTimes, err := k.stat()
+	if err != nil {
+		return err
+	}
+
+	return k.load(modTimes)
+}
+
+func (k *keyPairReloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "Error loading client certificate")
+	}
+
+	k.cert = &cert
+	k.modTimes = modTimes
+	return nil
+}
+
+func (k *keyPairReloader) stat() ([2]time.Time, error) {
+	modTimes := [2]time.Time{}
+	for i, file := range []string{k.certFile, k.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, errors.Wrap(err, "Error reading client certificate")
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
@@ -0,0 +1,274 @@
+package export
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testServerName = "telemetry.internal"
+
+// testCertificate is a certificate, signed by the test CA
+// (or self-signed if it is the CA), along with its key.
+type testCertificate struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, commonName string, ca *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{testServerName},
+	}
+
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &testCertificate{cert: cert, der: der, key: key}
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// write writes the certificate and its key as PEM files.
+func (c *testCertificate) write(t *testing.T, certFile string, keyFile string) {
+	key, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0644); err != nil {
+		t.Fatalf("Error writing certificate: %v", err)
+	}
+
+	if keyFile == "" {
+		return
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatalf("Error writing key: %v", err)
+	}
+}
+
+// newMutualTLSServer starts a TLS server requiring client certificates
+// signed by the CA, and records the common names they were issued to.
+func newMutualTLSServer(t *testing.T, ca *testCertificate) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	clients := []string{}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		clients = append(clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, "server", ca).tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, clients...)
+	}
+}
+
+func newTLSHTTP(t *testing.T, address string, tlsConfig TLSConfig) HTTP {
+	agent, err := NewHTTPWithConfig(HTTPConfig{Address: address, TLS: &tlsConfig}, config)
+	if err != nil {
+		t.Fatalf("Error creating HTTP exporter with TLS: %v", err)
+	}
+	agent.Stop()
+
+	return agent.Exporter.(HTTP)
+}
+
+func TestHTTPExportMetricsMutualTLS(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "ca", nil)
+	server, clients := newMutualTLSServer(t, ca)
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	ca.write(t, caFile, "")
+	newTestCertificate(t, "client", ca).write(t, certFile, keyFile)
+
+	exporter := newTLSHTTP(t, server.URL, TLSConfig{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: testServerName,
+		MinVersion: tls.VersionTLS12,
+	})
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTPS: %v", err)
+	}
+
+	if got := clients(); len(got) != 1 || got[0] != "client" {
+		t.Errorf("Mutual TLS failed, expected client certificate client, got %v", got)
+	}
+
+	// without a client certificate the handshake fails
+	exporter = newTLSHTTP(t, server.URL, TLSConfig{CAFile: caFile, ServerName: testServerName})
+	if err := exporter.ExportMetrics(context.Background(), metrics); err == nil {
+		t.Errorf("Expected error exporting metrics without a client certificate")
+	}
+
+	// the server's certificate isn't valid for its IP address
+	exporter = newTLSHTTP(t, server.URL, TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	if err := exporter.ExportMetrics(context.Background(), metrics); err == nil {
+		t.Errorf("Expected error exporting metrics without the server name")
+	}
+}
+
+func TestHTTPExportMetricsReloadCertificates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "ca", nil)
+	server, clients := newMutualTLSServer(t, ca)
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	ca.write(t, caFile, "")
+	newTestCertificate(t, "first", ca).write(t, certFile, keyFile)
+
+	exporter := newTLSHTTP(t, server.URL, TLSConfig{
+		CAFile:             caFile,
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		ServerName:         testServerName,
+		ReloadCertificates: true,
+	})
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTPS: %v", err)
+	}
+
+	// rotate the certificate, making sure its modification time changes
+	newTestCertificate(t, "second", ca).write(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTPS: %v", err)
+	}
+
+	want := []string{"first", "second"}
+	if got := clients(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Certificate reload failed, expected client certificates %v, got %v", want, got)
+	}
+}
+
+func TestHTTPExportMetricsReloadCA(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the server's certificate is signed by the CA rotated in
+	ca := newTestCertificate(t, "ca", nil)
+	server, clients := newMutualTLSServer(t, ca)
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	newTestCertificate(t, "previous-ca", nil).write(t, caFile, "")
+	newTestCertificate(t, "client", ca).write(t, certFile, keyFile)
+
+	exporter := newTLSHTTP(t, server.URL, TLSConfig{
+		CAFile:             caFile,
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		ServerName:         testServerName,
+		ReloadCertificates: true,
+	})
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err == nil {
+		t.Errorf("Expected error exporting metrics to a server signed by an untrusted CA")
+	}
+
+	ca.write(t, caFile, "")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(caFile, later, later)
+
+	if err := exporter.ExportMetrics(context.Background(), metrics); err != nil {
+		t.Fatalf("Error Exporting Metrics to HTTPS after the CA rotation: %v", err)
+	}
+
+	if got := clients(); len(got) != 1 || got[0] != "client" {
+		t.Errorf("CA reload failed, expected client certificate client, got %v", got)
+	}
+}
+
+func TestTLSConfigInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(emptyFile, nil, 0644)
+
+	tests := []TLSConfig{
+		{CAFile: filepath.Join(dir, "missing.pem")},
+		{CAFile: emptyFile},
+		{CertFile: emptyFile},
+		{CertFile: emptyFile, KeyFile: emptyFile},
+		{MinVersion: 0x1234},
+	}
+
+	for _, test := range tests {
+		if _, err := test.clientConfig(); err == nil {
+			t.Errorf("Expected error configuring TLS with %+v", test)
+		}
+	}
+}
@@ -7,12 +7,16 @@ require (
 	github.com/confluentinc/confluent-kafka-go v1.4.2
 	github.com/docker/docker v0.7.3-0.20190506211059-b20a14b54661
 	github.com/docker/go-connections v0.4.0
-	github.com/golang/protobuf v1.4.0
-	github.com/grpc-ecosystem/grpc-gateway v1.14.6 // indirect
+	github.com/gogo/protobuf v1.2.1 // indirect
+	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.1
+	github.com/klauspost/compress v1.11.13
 	github.com/pkg/errors v0.9.1
-	github.com/spf13/cobra v1.0.0 // indirect
 	github.com/testcontainers/testcontainers-go v0.7.0
 	go.opencensus.io v0.22.4
-	golang.org/x/tools v0.0.0-20200731060945-b5fad4ed8dd6 // indirect
-	google.golang.org/protobuf v1.23.0
+	go.opentelemetry.io/proto/otlp v0.9.0
+	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208 // indirect
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4 // indirect
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v2 v2.3.0
 )